@@ -0,0 +1,343 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"geecache"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 节点配置，对应 YAML 配置文件
+type config struct {
+	// 本节点在哈希环上的地址，必须与其他节点的 peers 中的写法一致。
+	// http 传输为 http(s)://host:port，grpc 传输为 host:port
+	Self string `yaml:"self"`
+	// 节点间通讯的监听地址，默认取 self 中的 host:port
+	Listen string `yaml:"listen"`
+	// 节点间的传输方式：http(默认) 或 grpc
+	Transport string `yaml:"transport"`
+	// 集群中的全部节点，包括自己。与 peersFile 都为空时只有本节点
+	Peers []string `yaml:"peers"`
+	// 节点发现文件，每行一个节点地址，# 开头的行为注释，文件修改后自动重新加载
+	PeersFile string `yaml:"peersFile"`
+	// 检查节点发现文件是否修改的间隔，默认是 5s
+	PeersFileInterval time.Duration `yaml:"peersFileInterval"`
+	// 探测其他节点健康状态的间隔，0 表示不探测，只对 http 传输有效
+	HealthCheck time.Duration `yaml:"healthCheck"`
+	// 一致性哈希的虚拟节点倍数，只对 http 传输有效
+	Replicas int `yaml:"replicas"`
+	// 对外提供 /api?group=<group>&key=<key> 的监听地址，为空时不启动
+	API string `yaml:"api"`
+	// 管理接口 /_admin/ 和 /metrics 的监听地址，为空时不启动。
+	// http 传输的节点间地址上也有同样的接口，但需要签名
+	Admin string `yaml:"admin"`
+	// 快照目录，每个缓存组一个 <group>.snap 文件，启动时加载，退出时保存
+	SnapshotDir string `yaml:"snapshotDir"`
+	// 节点间通讯的证书，只对 http 传输有效。请求签名的密钥从环境变量 GEECACHE_SECRET 读取
+	TLS    tlsConfig     `yaml:"tls"`
+	Groups []groupConfig `yaml:"groups"`
+
+	// 请求签名的密钥，从环境变量 GEECACHE_SECRET 读取，不在配置文件中
+	secret []byte
+}
+
+type tlsConfig struct {
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+	CA   string `yaml:"ca"`
+}
+
+// 缓存组配置，大小可以写成 64MB 这样的形式，时间写成 1m30s 这样的形式
+type groupConfig struct {
+	Name       string   `yaml:"name"`
+	CacheBytes byteSize `yaml:"cacheBytes"`
+	// hotCache 的最大字节数，默认为 cacheBytes 的 1/8，小于 0 表示不使用
+	HotCacheBytes byteSize      `yaml:"hotCacheBytes"`
+	TTL           time.Duration `yaml:"ttl"`
+	SoftTTL       time.Duration `yaml:"softTTL"`
+	NegativeTTL   time.Duration `yaml:"negativeTTL"`
+	Shards        int           `yaml:"shards"`
+	// 淘汰策略：lru(默认)、lfu、arc、2q 或 tinylfu
+	Policy string `yaml:"policy"`
+	// 磁盘缓存所在的目录和最大字节数，diskDir 为空时不使用磁盘缓存，diskBytes 为 0 表示不限制
+	DiskDir   string       `yaml:"diskDir"`
+	DiskBytes byteSize     `yaml:"diskBytes"`
+	Loader    loaderConfig `yaml:"loader"`
+}
+
+// 数据源配置，options 的格式由 type 对应的数据源决定
+type loaderConfig struct {
+	Type    string    `yaml:"type"`
+	Options yaml.Node `yaml:"options"`
+}
+
+var policies = map[string]geecache.PolicyFunc{
+	"lru":     geecache.LRU,
+	"lfu":     geecache.LFU,
+	"arc":     geecache.ARC,
+	"2q":      geecache.TwoQ,
+	"tinylfu": geecache.TinyLFU,
+}
+
+const defaultPeersFileInterval = 5 * time.Second
+
+// 字节数，YAML 中可以写整数或带 B、KB、MB、GB 后缀(1024 进制)的字符串
+type byteSize int64
+
+func (b *byteSize) UnmarshalYAML(value *yaml.Node) error {
+	s := strings.ToUpper(strings.TrimSpace(value.Value))
+	mult := int64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid size %q", value.Line, value.Value)
+	}
+	*b = byteSize(n * mult)
+	return nil
+}
+
+// 读取配置文件，未知的字段视为错误
+func loadConfig(path string) (*config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cfg := &config{}
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// 填充默认值
+func (c *config) setDefaults() {
+	if c.Transport == "" {
+		c.Transport = "http"
+	}
+	if c.Listen == "" {
+		c.Listen = hostPort(c.Self)
+	}
+	if c.PeersFileInterval == 0 {
+		c.PeersFileInterval = defaultPeersFileInterval
+	}
+	for i := range c.Groups {
+		if c.Groups[i].Policy == "" {
+			c.Groups[i].Policy = "lru"
+		}
+	}
+}
+
+// 检查配置，返回所有发现的问题
+func (c *config) validate() error {
+	var errs []error
+	fail := func(format string, v ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, v...))
+	}
+
+	switch c.Transport {
+	case "http", "grpc":
+	default:
+		fail("transport: unknown transport %q, want http or grpc", c.Transport)
+	}
+	if c.Self == "" {
+		fail("self: required")
+	} else if err := c.checkPeer(c.Self); err != nil {
+		fail("self: %v", err)
+	}
+	if c.Listen != "" {
+		checkAddr("listen", c.Listen, fail)
+	}
+	if c.API != "" {
+		checkAddr("api", c.API, fail)
+	}
+	if c.Admin != "" {
+		checkAddr("admin", c.Admin, fail)
+	}
+	seen := map[string]string{}
+	for _, l := range []struct{ name, addr string }{{"listen", c.Listen}, {"api", c.API}, {"admin", c.Admin}} {
+		if l.addr == "" {
+			continue
+		}
+		if other, ok := seen[l.addr]; ok {
+			fail("%s: address %s is already used by %s", l.name, l.addr, other)
+		}
+		seen[l.addr] = l.name
+	}
+
+	if len(c.Peers) > 0 && c.PeersFile != "" {
+		fail("peers and peersFile are mutually exclusive")
+	}
+	if len(c.Peers) > 0 {
+		if err := c.checkPeers(c.Peers); err != nil {
+			fail("peers: %v", err)
+		}
+	}
+	if c.PeersFile != "" {
+		if c.PeersFileInterval < 0 {
+			fail("peersFileInterval: must not be negative")
+		}
+		// 启动时文件必须存在且内容正确，之后的修改如果有错误只记录日志
+		if peers, err := readPeersFile(c.PeersFile); err != nil {
+			fail("peersFile: %v", err)
+		} else if err := c.checkPeers(peers); err != nil {
+			fail("peersFile %s: %v", c.PeersFile, err)
+		}
+	}
+	if c.HealthCheck < 0 {
+		fail("healthCheck: must not be negative")
+	}
+	if c.Replicas < 0 {
+		fail("replicas: must not be negative")
+	}
+
+	if c.TLS != (tlsConfig{}) {
+		if c.Transport == "grpc" {
+			fail("tls: only supported by the http transport")
+		}
+		if c.TLS.Cert == "" || c.TLS.Key == "" {
+			fail("tls: cert and key are both required")
+		}
+	}
+	// grpc 传输没有 TLS 和签名，不能悄悄地以明文、不校验签名的方式启动
+	if c.Transport == "grpc" && len(c.secret) > 0 {
+		fail("GEECACHE_SECRET: request signing is only supported by the http transport")
+	}
+	if c.Transport == "http" && c.Self != "" && strings.HasPrefix(c.Self, "https://") != (c.TLS.Cert != "") {
+		fail("self: use https:// together with tls.cert and tls.key, http:// without them")
+	}
+	if c.SnapshotDir != "" {
+		if fi, err := os.Stat(c.SnapshotDir); err != nil {
+			fail("snapshotDir: %v", err)
+		} else if !fi.IsDir() {
+			fail("snapshotDir: %s is not a directory", c.SnapshotDir)
+		}
+	}
+
+	if len(c.Groups) == 0 {
+		fail("groups: at least one group is required")
+	}
+	names := map[string]bool{}
+	for i, g := range c.Groups {
+		prefix := fmt.Sprintf("groups[%d]", i)
+		if g.Name == "" {
+			fail("%s: name is required", prefix)
+		} else {
+			prefix = fmt.Sprintf("groups[%s]", g.Name)
+			if names[g.Name] {
+				fail("%s: duplicate group name", prefix)
+			}
+			names[g.Name] = true
+		}
+		if g.CacheBytes < 0 {
+			fail("%s: cacheBytes must not be negative", prefix)
+		}
+		if g.TTL < 0 || g.SoftTTL < 0 || g.NegativeTTL < 0 {
+			fail("%s: ttl, softTTL and negativeTTL must not be negative", prefix)
+		}
+		if g.TTL > 0 && g.SoftTTL >= g.TTL {
+			fail("%s: softTTL must be shorter than ttl", prefix)
+		}
+		if g.Shards < 0 {
+			fail("%s: shards must not be negative", prefix)
+		}
+		if _, ok := policies[g.Policy]; !ok {
+			fail("%s: unknown policy %q", prefix, g.Policy)
+		}
+		if g.DiskBytes < 0 {
+			fail("%s: diskBytes must not be negative", prefix)
+		}
+		if g.DiskBytes > 0 && g.DiskDir == "" {
+			fail("%s: diskBytes requires diskDir", prefix)
+		}
+		if g.Loader.Type == "" {
+			fail("%s: loader.type is required", prefix)
+		} else if _, ok := loaderFactories[g.Loader.Type]; !ok {
+			fail("%s: unknown loader type %q, available: %s", prefix, g.Loader.Type, strings.Join(loaderTypes(), ", "))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 检查节点地址的格式是否符合传输方式
+func (c *config) checkPeer(peer string) error {
+	switch {
+	case c.Transport == "grpc":
+		if strings.Contains(peer, "://") {
+			return fmt.Errorf("%q: grpc peers are host:port without a scheme", peer)
+		}
+	case strings.HasPrefix(peer, "http://"), strings.HasPrefix(peer, "https://"):
+	default:
+		return fmt.Errorf("%q: http peers must start with http:// or https://", peer)
+	}
+	if _, _, err := net.SplitHostPort(hostPort(peer)); err != nil {
+		return fmt.Errorf("%q: %v", peer, err)
+	}
+	return nil
+}
+
+// 检查节点列表，列表中必须包含本节点
+func (c *config) checkPeers(peers []string) error {
+	var errs []error
+	hasSelf := false
+	for _, peer := range peers {
+		if err := c.checkPeer(peer); err != nil {
+			errs = append(errs, err)
+		}
+		hasSelf = hasSelf || peer == c.Self
+	}
+	if !hasSelf {
+		errs = append(errs, fmt.Errorf("self %q is not in the list", c.Self))
+	}
+	return errors.Join(errs...)
+}
+
+// 去掉地址中的 scheme，返回 host:port
+func hostPort(addr string) string {
+	if i := strings.Index(addr, "://"); i >= 0 {
+		return addr[i+3:]
+	}
+	return addr
+}
+
+func checkAddr(name, addr string, fail func(string, ...interface{})) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		fail("%s: %v", name, err)
+	}
+}
+
+// 读取节点发现文件
+func readPeersFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var peers []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		peers = append(peers, line)
+	}
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("%s: no peers", path)
+	}
+	return peers, nil
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 一份可以通过检查的配置，各个测试在副本上修改
+func validConfig() *config {
+	cfg := &config{
+		Self:   "http://localhost:8001",
+		Peers:  []string{"http://localhost:8001", "http://localhost:8002"},
+		Groups: []groupConfig{{Name: "scores", CacheBytes: 1 << 20, Loader: loaderConfig{Type: "static"}}},
+	}
+	cfg.setDefaults()
+	return cfg
+}
+
+// 测试配置检查
+// 测试步骤
+//  1. 每个用例修改一项配置，错误信息中包含对应的字段
+//  2. 有多个错误时全部返回
+//  3. grpc 传输不能和 tls、GEECACHE_SECRET 一起使用
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *config)
+		want   []string
+	}{
+		{"valid", func(c *config) {}, nil},
+		{"no self", func(c *config) { c.Self, c.Peers = "", nil }, []string{"self: required"}},
+		{"bad transport", func(c *config) { c.Transport = "udp" }, []string{`unknown transport "udp"`}},
+		{"self not in peers", func(c *config) { c.Peers = []string{"http://localhost:8002"} }, []string{"is not in the list"}},
+		{"same address", func(c *config) { c.API = "localhost:8001" }, []string{"api: address localhost:8001 is already used by listen"}},
+		{"grpc with tls", func(c *config) {
+			c.Transport, c.Self, c.Peers = "grpc", "localhost:8001", nil
+			c.TLS = tlsConfig{Cert: "cert.pem", Key: "key.pem"}
+		}, []string{"tls: only supported by the http transport"}},
+		{"grpc with secret", func(c *config) {
+			c.Transport, c.Self, c.Peers = "grpc", "localhost:8001", nil
+			c.secret = []byte("secret")
+		}, []string{"GEECACHE_SECRET: request signing is only supported by the http transport"}},
+		{"http with secret", func(c *config) { c.secret = []byte("secret") }, nil},
+		{"multiple errors", func(c *config) {
+			c.Replicas = -1
+			c.Groups = append(c.Groups,
+				groupConfig{Name: "scores", Policy: "fifo", Loader: loaderConfig{Type: "static"}},
+				groupConfig{Name: "ttl", Policy: "lru", TTL: 1, SoftTTL: 2, Loader: loaderConfig{Type: "redis"}})
+		}, []string{
+			"replicas: must not be negative",
+			"groups[scores]: duplicate group name",
+			`groups[scores]: unknown policy "fifo"`,
+			"groups[ttl]: softTTL must be shorter than ttl",
+			`groups[ttl]: unknown loader type "redis"`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(cfg)
+			err := cfg.validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("validate() = nil, want %q", tt.want)
+			}
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(tt.want) {
+				t.Fatalf("validate() returned %d errors, want %d:\n%v", len(lines), len(tt.want), err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("validate() = %v, missing %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+// 测试字节数的解析
+func TestByteSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want byteSize
+		err  bool
+	}{
+		{"1024", 1024, false},
+		{"0", 0, false},
+		{"-1", -1, false},
+		{"10B", 10, false},
+		{"2KB", 2 << 10, false},
+		{"64mb", 64 << 20, false},
+		{" 1 GB ", 1 << 30, false},
+		{"1.5MB", 0, true},
+		{"MB", 0, true},
+		{"64MiB", 0, true},
+	}
+	for _, tt := range tests {
+		var v struct {
+			Size byteSize `yaml:"size"`
+		}
+		err := yaml.Unmarshal([]byte("size: "+`"`+tt.in+`"`), &v)
+		if (err != nil) != tt.err || v.Size != tt.want {
+			t.Errorf("byteSize(%q) = %d, %v, want %d, error %v", tt.in, v.Size, err, tt.want, tt.err)
+		}
+	}
+}
+
+// 测试数据源 options 的解码
+// 测试步骤
+//  1. 没有 options 时保持默认值
+//  2. 已知字段正常解码，未知字段报告所在的行
+//  3. 类型错误时返回 yaml 的错误
+func TestDecodeOptions(t *testing.T) {
+	type options struct {
+		Dir string `yaml:"dir"`
+		Ext string `yaml:"ext,omitempty"`
+	}
+	tests := []struct {
+		name string
+		in   string
+		want options
+		err  string
+	}{
+		{"empty", "", options{Dir: "default"}, ""},
+		{"known", "options:\n  dir: /srv\n  ext: .json\n", options{Dir: "/srv", Ext: ".json"}, ""},
+		{"unknown", "options:\n  dir: /srv\n  exts: .json\n", options{Dir: "/srv"}, `line 3: unknown option "exts"`},
+		{"wrong type", "options: [a, b]\n", options{Dir: "default"}, "cannot unmarshal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var loader loaderConfig
+			if err := yaml.Unmarshal([]byte(tt.in), &loader); err != nil {
+				t.Fatal(err)
+			}
+			got := options{Dir: "default"}
+			err := decodeOptions(&loader.Options, &got)
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("decodeOptions() error = %v, want %q", err, tt.err)
+			}
+			if got != tt.want {
+				t.Fatalf("decodeOptions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 测试节点发现文件的读取和检查
+// 测试步骤
+//  1. 忽略空行和注释，文件为空或不存在时返回错误
+//  2. 地址格式与传输方式不符、缺少本节点时，所有问题一起返回
+func TestPeersFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	peers, err := readPeersFile(write("peers", "# cluster\nhttp://localhost:8001\n\n  http://localhost:8002  \n"))
+	if err != nil || !reflect.DeepEqual(peers, []string{"http://localhost:8001", "http://localhost:8002"}) {
+		t.Fatalf("readPeersFile() = %q, %v", peers, err)
+	}
+	if _, err := readPeersFile(write("empty", "# nothing\n\n")); err == nil || !strings.Contains(err.Error(), "no peers") {
+		t.Fatalf("readPeersFile(empty) = %v, want no peers", err)
+	}
+	if _, err := readPeersFile(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Fatalf("readPeersFile(missing) = %v, want not exist", err)
+	}
+
+	tests := []struct {
+		name      string
+		transport string
+		self      string
+		peers     []string
+		want      []string
+	}{
+		{"http", "http", "http://localhost:8001", []string{"http://localhost:8001", "https://localhost:8002"}, nil},
+		{"grpc", "grpc", "localhost:8001", []string{"localhost:8001", "localhost:8002"}, nil},
+		{"no scheme", "http", "http://localhost:8001", []string{"http://localhost:8001", "localhost:8002"},
+			[]string{"must start with http://"}},
+		{"grpc scheme", "grpc", "localhost:8001", []string{"localhost:8001", "http://localhost:8002"},
+			[]string{"without a scheme"}},
+		{"no port and no self", "http", "http://localhost:8001", []string{"http://localhost"},
+			[]string{"missing port", "is not in the list"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &config{Transport: tt.transport, Self: tt.self}
+			err := c.checkPeers(tt.peers)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("checkPeers() = %v", err)
+				}
+				return
+			}
+			for _, want := range tt.want {
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("checkPeers() = %v, missing %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+// 测试命令行参数覆盖配置文件
+// 测试步骤
+//  1. 只覆盖命令行中出现的参数，即使参数值为空
+//  2. -peers 按逗号分隔
+//  3. 未知的参数返回错误
+func TestFlagsApply(t *testing.T) {
+	f, err := parseFlags([]string{"-config", "geecache.yaml", "-check", "-self", "http://localhost:9001",
+		"-peers", "http://localhost:9001,http://localhost:9002", "-admin", ""}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.configFile != "geecache.yaml" || !f.check {
+		t.Fatalf("parseFlags() = %+v", f)
+	}
+	cfg := &config{
+		Self:   "http://localhost:8001",
+		Listen: "localhost:8001",
+		Peers:  []string{"http://localhost:8001"},
+		API:    "localhost:9999",
+		Admin:  "localhost:9998",
+	}
+	f.apply(cfg)
+	want := &config{
+		Self:   "http://localhost:9001",
+		Listen: "localhost:8001",
+		Peers:  []string{"http://localhost:9001", "http://localhost:9002"},
+		API:    "localhost:9999",
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Fatalf("apply() = %+v, want %+v", cfg, want)
+	}
+
+	f, err = parseFlags(nil, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := *validConfig()
+	cfg = validConfig()
+	f.apply(cfg)
+	if !reflect.DeepEqual(*cfg, before) {
+		t.Fatalf("apply() without flags changed the config: %+v", cfg)
+	}
+
+	if _, err := parseFlags([]string{"-unknown"}, io.Discard); err == nil {
+		t.Fatalf("parseFlags(-unknown) should fail")
+	}
+}
@@ -0,0 +1,4 @@
+package main
+
+// sql 数据源可以使用的数据库驱动，需要其他数据库时在这里导入对应的驱动
+import _ "github.com/mattn/go-sqlite3"
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"geecache"
+	"geecache/loaders"
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 根据配置中的 options 创建缓存组的数据源
+type loaderFactory func(group string, options *yaml.Node) (geecache.Getter, error)
+
+// 可用的数据源，key 为配置中 loader.type 的值。新的数据源在这里注册
+var loaderFactories = map[string]loaderFactory{
+	"static": newStaticLoader,
+	"sql":    newSQLLoader,
+	"file":   newFileLoader,
+	"http":   newHTTPLoader,
+}
+
+// 按名字排序的数据源类型，用于错误提示
+func loaderTypes() []string {
+	types := make([]string, 0, len(loaderFactories))
+	for t := range loaderFactories {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// 将 options 解码到 v 中，v 必须是结构体指针，未知的字段视为错误。没有 options 时 v 保持不变
+func decodeOptions(options *yaml.Node, v interface{}) error {
+	if options.Kind == 0 {
+		return nil
+	}
+	if err := options.Decode(v); err != nil {
+		return err
+	}
+	// yaml.Node.Decode 不支持 KnownFields，按结构体的 yaml 标签检查
+	if options.Kind == yaml.MappingNode {
+		t := reflect.TypeOf(v).Elem()
+		known := make(map[string]bool, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			known[strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]] = true
+		}
+		for i := 0; i < len(options.Content); i += 2 {
+			if k := options.Content[i]; !known[k.Value] {
+				return fmt.Errorf("line %d: unknown option %q", k.Line, k.Value)
+			}
+		}
+	}
+	return nil
+}
+
+// static 数据源直接返回配置文件中的值，不存在的 key 返回 ErrNotFound。
+// 没有 values 时所有 key 都不存在，缓存值只能通过 Set 写入
+//
+//	loader:
+//	  type: static
+//	  options:
+//	    values:
+//	      Tom: "630"
+func newStaticLoader(group string, options *yaml.Node) (geecache.Getter, error) {
+	var opts struct {
+		Values map[string]string `yaml:"values"`
+	}
+	if err := decodeOptions(options, &opts); err != nil {
+		return nil, err
+	}
+	return geecache.GetterFunc(func(key string) ([]byte, error) {
+		v, ok := opts.Values[key]
+		if !ok {
+			return nil, fmt.Errorf("%s/%s: %w", group, key, geecache.ErrNotFound)
+		}
+		return []byte(v), nil
+	}), nil
+}
+
+// sql 数据源用一条查询语句加载，驱动需要链接进程序，见 drivers.go。
+//
+//	loader:
+//	  type: sql
+//	  options:
+//	    driver: sqlite3
+//	    dsn: file:scores.db?mode=ro
+//	    query: SELECT score FROM scores WHERE name = ?
+//	    timeout: 1s
+func newSQLLoader(group string, options *yaml.Node) (geecache.Getter, error) {
+	var opts struct {
+		Driver  string        `yaml:"driver"`
+		DSN     string        `yaml:"dsn"`
+		Query   string        `yaml:"query"`
+		Timeout time.Duration `yaml:"timeout"`
+	}
+	if err := decodeOptions(options, &opts); err != nil {
+		return nil, err
+	}
+	if opts.Query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	if !slices.Contains(sql.Drivers(), opts.Driver) {
+		return nil, fmt.Errorf("unknown driver %q, available: %s", opts.Driver, strings.Join(sql.Drivers(), ", "))
+	}
+	db, err := sql.Open(opts.Driver, opts.DSN)
+	if err != nil {
+		return nil, err
+	}
+	return &loaders.SQL{DB: db, Query: opts.Query, Timeout: opts.Timeout}, nil
+}
+
+// file 数据源读取目录中与 key 同名的文件。
+//
+//	loader:
+//	  type: file
+//	  options:
+//	    dir: /srv/data
+//	    ext: .json
+func newFileLoader(group string, options *yaml.Node) (geecache.Getter, error) {
+	var opts struct {
+		Dir     string        `yaml:"dir"`
+		Ext     string        `yaml:"ext"`
+		Timeout time.Duration `yaml:"timeout"`
+	}
+	if err := decodeOptions(options, &opts); err != nil {
+		return nil, err
+	}
+	if fi, err := os.Stat(opts.Dir); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", opts.Dir)
+	}
+	f := loaders.NewDir(opts.Dir)
+	f.Ext, f.Timeout = opts.Ext, opts.Timeout
+	return f, nil
+}
+
+// http 数据源从上游服务加载，支持 ETag。
+//
+//	loader:
+//	  type: http
+//	  options:
+//	    url: http://users.internal/v1/users/{key}
+//	    header:
+//	      Authorization: Bearer xxx
+//	    timeout: 2s
+//	    maxBytes: 1MB
+func newHTTPLoader(group string, options *yaml.Node) (geecache.Getter, error) {
+	var opts struct {
+		URL            string            `yaml:"url"`
+		Header         map[string]string `yaml:"header"`
+		Timeout        time.Duration     `yaml:"timeout"`
+		MaxBytes       byteSize          `yaml:"maxBytes"`
+		ETagCacheBytes byteSize          `yaml:"etagCacheBytes"`
+	}
+	if err := decodeOptions(options, &opts); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(opts.URL, "http://") && !strings.HasPrefix(opts.URL, "https://") {
+		return nil, fmt.Errorf("url must start with http:// or https://")
+	}
+	h := &loaders.HTTP{
+		URL:            opts.URL,
+		Header:         make(http.Header, len(opts.Header)),
+		Timeout:        opts.Timeout,
+		MaxBytes:       int64(opts.MaxBytes),
+		ETagCacheBytes: int64(opts.ETagCacheBytes),
+	}
+	for k, v := range opts.Header {
+		h.Header.Set(k, v)
+	}
+	return h, nil
+}
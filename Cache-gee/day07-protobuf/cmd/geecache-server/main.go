@@ -0,0 +1,398 @@
+// geecache-server 根据配置文件启动一个 GeeCache 节点。
+//
+// 用法：
+//
+//	geecache-server -config geecache.yaml [-self addr] [-peers a,b,c] [-check]
+//
+// 配置文件的格式见 geecache.example.yaml，命令行参数覆盖配置文件中的同名配置。
+// 所有配置在监听端口之前检查，有错误时全部列出后退出；-check 只检查配置。
+// 节点间请求签名的密钥从环境变量 GEECACHE_SECRET 读取，只支持 http 传输。
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"geecache"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 节点间的传输方式，HTTPPool 和 GRPCPool 都实现了该接口
+type peerPool interface {
+	geecache.PeerPicker
+	Set(peers ...string)
+}
+
+// 命令行参数
+type flags struct {
+	set        *flag.FlagSet
+	configFile string
+	check      bool
+	override   config
+	peers      string
+}
+
+// 解析命令行参数，错误和用法说明写入 output
+func parseFlags(args []string, output io.Writer) (*flags, error) {
+	f := &flags{set: flag.NewFlagSet("geecache-server", flag.ContinueOnError)}
+	fs := f.set
+	fs.SetOutput(output)
+	fs.StringVar(&f.configFile, "config", "", "YAML config file")
+	fs.BoolVar(&f.check, "check", false, "Only validate the config and exit")
+	fs.StringVar(&f.override.Self, "self", "", "Address of this node on the hash ring, overrides self")
+	fs.StringVar(&f.override.Listen, "listen", "", "Listen address for peer requests, overrides listen")
+	fs.StringVar(&f.override.Transport, "transport", "", "Peer transport: http or grpc, overrides transport")
+	fs.StringVar(&f.peers, "peers", "", "Comma separated peer addresses, overrides peers")
+	fs.StringVar(&f.override.PeersFile, "peers-file", "", "Peer discovery file, overrides peersFile")
+	fs.StringVar(&f.override.API, "api", "", "Listen address of the API server, overrides api")
+	fs.StringVar(&f.override.Admin, "admin", "", "Listen address of the admin server, overrides admin")
+	fs.StringVar(&f.override.SnapshotDir, "snapshot-dir", "", "Snapshot directory, overrides snapshotDir")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// 用命令行参数覆盖配置，只覆盖命令行中出现的参数
+func (f *flags) apply(cfg *config) {
+	f.set.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "self":
+			cfg.Self = f.override.Self
+		case "listen":
+			cfg.Listen = f.override.Listen
+		case "transport":
+			cfg.Transport = f.override.Transport
+		case "peers":
+			cfg.Peers = strings.Split(f.peers, ",")
+		case "peers-file":
+			cfg.PeersFile = f.override.PeersFile
+		case "api":
+			cfg.API = f.override.API
+		case "admin":
+			cfg.Admin = f.override.Admin
+		case "snapshot-dir":
+			cfg.SnapshotDir = f.override.SnapshotDir
+		}
+	})
+}
+
+func main() {
+	f, err := parseFlags(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+
+	cfg := &config{}
+	if f.configFile != "" {
+		if cfg, err = loadConfig(f.configFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	f.apply(cfg)
+	cfg.secret = []byte(os.Getenv("GEECACHE_SECRET"))
+	cfg.setDefaults()
+
+	n, err := newNode(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid config:")
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintln(os.Stderr, "  "+line)
+		}
+		os.Exit(2)
+	}
+	if f.check {
+		for _, disk := range n.disks {
+			disk.Close()
+		}
+		fmt.Println("config ok")
+		return
+	}
+	log.Fatal(n.run())
+}
+
+// 根据配置创建的节点
+type node struct {
+	cfg    *config
+	opts   *geecache.HTTPPoolOptions
+	groups []*geecache.Group
+	// 各缓存组的磁盘缓存，退出时删除文件
+	disks []*geecache.DiskTier
+	pool  peerPool
+}
+
+// 检查配置并创建数据源和缓存组，只有全部成功时才返回节点
+func newNode(cfg *config) (*node, error) {
+	n := &node{
+		cfg:  cfg,
+		opts: &geecache.HTTPPoolOptions{Replicas: cfg.Replicas, Secret: cfg.secret},
+	}
+	errs := []error{cfg.validate()}
+	if cfg.TLS.Cert != "" && cfg.TLS.Key != "" {
+		tlsCfg, err := geecache.LoadTLSConfig(cfg.TLS.Cert, cfg.TLS.Key, cfg.TLS.CA)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tls: %v", err))
+		}
+		n.opts.TLSConfig = tlsCfg
+	}
+	// 先创建所有数据源和磁盘缓存，缓存组会注册到全局，只在没有错误时创建
+	getters := make([]geecache.Getter, len(cfg.Groups))
+	disks := make([]*geecache.DiskTier, len(cfg.Groups))
+	for i, g := range cfg.Groups {
+		if g.DiskDir != "" {
+			disk, err := geecache.OpenDiskTier(g.DiskDir, int64(g.DiskBytes))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("groups[%s]: diskDir: %v", g.Name, err))
+			}
+			disks[i] = disk
+		}
+		newLoader, ok := loaderFactories[g.Loader.Type]
+		if !ok {
+			// validate 已经报告过
+			continue
+		}
+		getter, err := newLoader(g.Name, &g.Loader.Options)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("groups[%s]: loader %s: %v", g.Name, g.Loader.Type, err))
+		}
+		getters[i] = getter
+	}
+	if err := errors.Join(errs...); err != nil {
+		for _, disk := range disks {
+			if disk != nil {
+				disk.Close()
+			}
+		}
+		return nil, err
+	}
+
+	for i, g := range cfg.Groups {
+		opts := []geecache.GroupOption{
+			geecache.WithTTL(g.TTL),
+			geecache.WithSoftTTL(g.SoftTTL),
+			geecache.WithNegativeTTL(g.NegativeTTL),
+			geecache.WithPolicy(policies[g.Policy]),
+		}
+		if g.Shards > 0 {
+			opts = append(opts, geecache.WithShards(g.Shards))
+		}
+		if g.HotCacheBytes != 0 {
+			opts = append(opts, geecache.WithHotCache(int64(g.HotCacheBytes)))
+		}
+		if disks[i] != nil {
+			opts = append(opts, geecache.WithDiskTier(disks[i]))
+			n.disks = append(n.disks, disks[i])
+		}
+		n.groups = append(n.groups, geecache.NewGroup(g.Name, int64(g.CacheBytes), getters[i], opts...))
+	}
+	return n, nil
+}
+
+// 打开所有监听端口，加入集群并开始处理请求，返回第一个退出的服务的错误
+func (n *node) run() error {
+	cfg := n.cfg
+	// 先打开所有端口，任何一个失败时都不对外提供服务
+	var listeners []net.Listener
+	listen := func(addr string) (net.Listener, error) {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+		return l, nil
+	}
+	peerL, err := listen(cfg.Listen)
+	if err != nil {
+		return err
+	}
+	var apiL, adminL net.Listener
+	if cfg.API != "" {
+		if apiL, err = listen(cfg.API); err != nil {
+			return err
+		}
+	}
+	if cfg.Admin != "" {
+		if adminL, err = listen(cfg.Admin); err != nil {
+			return err
+		}
+	}
+
+	// 在加入节点池之前恢复缓存
+	if cfg.SnapshotDir != "" {
+		n.restoreSnapshots()
+	}
+	n.handleSignals()
+
+	peers := cfg.Peers
+	if cfg.PeersFile != "" {
+		// validate 已经检查过文件内容
+		peers, _ = readPeersFile(cfg.PeersFile)
+	}
+	if len(peers) == 0 {
+		peers = []string{cfg.Self}
+	}
+	errc := make(chan error, 3)
+	switch cfg.Transport {
+	case "http":
+		pool := geecache.NewHTTPPoolOpts(cfg.Self, n.opts)
+		pool.Set(peers...)
+		if cfg.HealthCheck > 0 {
+			pool.StartHealthCheck(cfg.HealthCheck)
+		}
+		n.pool = pool
+		go func() { errc <- pool.Serve(peerL) }()
+	case "grpc":
+		pool := geecache.NewGRPCPool(cfg.Self)
+		pool.Set(peers...)
+		n.pool = pool
+		go func() { errc <- pool.NewServer().Serve(peerL) }()
+	}
+	for _, g := range n.groups {
+		g.RegisterPeers(n.pool)
+	}
+	if cfg.PeersFile != "" {
+		go n.watchPeersFile(peers)
+	}
+	log.Printf("geecache is running at %s (%s, %d peers)", cfg.Self, cfg.Transport, len(peers))
+
+	if apiL != nil {
+		log.Println("api server is running at", cfg.API)
+		go func() { errc <- http.Serve(apiL, n.apiHandler()) }()
+	}
+	if adminL != nil {
+		log.Println("admin server is running at", cfg.Admin)
+		go func() { errc <- http.Serve(adminL, adminHandler()) }()
+	}
+	return <-errc
+}
+
+// 对外提供的接口：GET /api?group=<group>&key=<key>，只有一个缓存组时可以省略 group
+func (n *node) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		name, key := r.URL.Query().Get("group"), r.URL.Query().Get("key")
+		if name == "" && len(n.groups) == 1 {
+			name = n.groups[0].Name()
+		}
+		g := geecache.GetGroup(name)
+		if g == nil {
+			http.Error(w, "no such group: "+name, http.StatusNotFound)
+			return
+		}
+		view, err := g.GetContext(r.Context(), key)
+		if errors.Is(err, geecache.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		view.WriteTo(w)
+	})
+	return mux
+}
+
+// 管理接口和 Prometheus 指标，不校验签名，应只监听在内网地址上
+func adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/_admin/", geecache.NewAdminHandler("/_admin"))
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		geecache.WriteMetrics(w)
+	})
+	return mux
+}
+
+// 定期检查节点发现文件，内容变化时重新设置节点。文件内容有错误时保留原来的节点
+func (n *node) watchPeersFile(peers []string) {
+	var modTime time.Time
+	if fi, err := os.Stat(n.cfg.PeersFile); err == nil {
+		modTime = fi.ModTime()
+	}
+	for range time.Tick(n.cfg.PeersFileInterval) {
+		fi, err := os.Stat(n.cfg.PeersFile)
+		if err != nil {
+			log.Printf("peers file: %v", err)
+			continue
+		}
+		if fi.ModTime().Equal(modTime) {
+			continue
+		}
+		modTime = fi.ModTime()
+		next, err := readPeersFile(n.cfg.PeersFile)
+		if err == nil {
+			err = n.cfg.checkPeers(next)
+		}
+		if err != nil {
+			log.Printf("ignore peers file %s: %v", n.cfg.PeersFile, err)
+			continue
+		}
+		if slices.Equal(next, peers) {
+			continue
+		}
+		peers = next
+		n.pool.Set(peers...)
+		log.Printf("peers changed: %s", strings.Join(peers, ", "))
+	}
+}
+
+// 缓存组的快照文件
+func (n *node) snapshotPath(g *geecache.Group) string {
+	return filepath.Join(n.cfg.SnapshotDir, g.Name()+".snap")
+}
+
+// 启动时从快照恢复缓存
+func (n *node) restoreSnapshots() {
+	for _, g := range n.groups {
+		count, err := g.LoadSnapshotFile(n.snapshotPath(g))
+		if err != nil {
+			// 快照损坏时忽略，缓存组以空缓存启动
+			log.Printf("ignore snapshot %s: %v", n.snapshotPath(g), err)
+			continue
+		}
+		log.Printf("restored %d entries from %s", count, n.snapshotPath(g))
+	}
+}
+
+// 收到退出信号时保存快照、删除磁盘缓存的文件后退出
+func (n *node) handleSignals() {
+	if n.cfg.SnapshotDir == "" && len(n.disks) == 0 {
+		return
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		if n.cfg.SnapshotDir != "" {
+			for _, g := range n.groups {
+				if err := g.SaveSnapshotFile(n.snapshotPath(g)); err != nil {
+					log.Printf("save snapshot %s: %v", n.snapshotPath(g), err)
+				}
+			}
+		}
+		for _, disk := range n.disks {
+			if err := disk.Close(); err != nil {
+				log.Print(err)
+			}
+		}
+		os.Exit(0)
+	}()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	pb "geecache/geecachepb"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 压测结果
+type benchResult struct {
+	Requests   int           `json:"requests"`
+	Errors     int           `json:"errors"`
+	NotFound   int           `json:"notFound"`
+	Duration   time.Duration `json:"durationNs"`
+	Throughput float64       `json:"throughput"`
+	P50        time.Duration `json:"p50Ns"`
+	P90        time.Duration `json:"p90Ns"`
+	P99        time.Duration `json:"p99Ns"`
+	Max        time.Duration `json:"maxNs"`
+}
+
+// bench 并发地从负责各 key 的节点获取 <prefix><0..keys-1>，统计吞吐量和延迟分布
+func (c *cli) bench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	n := fs.Int("n", 10000, "Total number of requests")
+	concurrency := fs.Int("c", 16, "Number of concurrent workers")
+	keys := fs.Int("keys", 1000, "Number of distinct keys")
+	prefix := fs.String("prefix", "key", "Key prefix")
+	fs.Parse(args)
+	if *n <= 0 || *concurrency <= 0 || *keys <= 0 {
+		return fmt.Errorf("-n, -c and -keys must be positive")
+	}
+
+	var (
+		mu        sync.Mutex
+		latencies = make([]time.Duration, 0, *n)
+		res       benchResult
+		wg        sync.WaitGroup
+	)
+	// 每个 worker 从 next 中领取请求，总数为 n
+	next := make(chan struct{}, *n)
+	for i := 0; i < *n; i++ {
+		next <- struct{}{}
+	}
+	close(next)
+
+	start := time.Now()
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for range next {
+				key := *prefix + strconv.Itoa(r.Intn(*keys))
+				begin := time.Now()
+				out, err := c.fetch(context.Background(), key)
+				d := time.Since(begin)
+				mu.Lock()
+				latencies = append(latencies, d)
+				switch {
+				case err != nil:
+					res.Errors++
+				case out.Status == pb.Status_NOT_FOUND:
+					res.NotFound++
+				}
+				mu.Unlock()
+			}
+		}(time.Now().UnixNano() + int64(i))
+	}
+	wg.Wait()
+
+	res.Requests = len(latencies)
+	res.Duration = time.Since(start)
+	res.Throughput = float64(res.Requests) / res.Duration.Seconds()
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p float64) time.Duration {
+		return latencies[int(float64(len(latencies)-1)*p)]
+	}
+	res.P50, res.P90, res.P99, res.Max = percentile(0.5), percentile(0.9), percentile(0.99), latencies[len(latencies)-1]
+
+	if c.asJSON {
+		return c.printJSON(res)
+	}
+	fmt.Fprintf(c.out, "requests:   %d (%d errors, %d not found)\n", res.Requests, res.Errors, res.NotFound)
+	fmt.Fprintf(c.out, "duration:   %v\n", res.Duration.Round(time.Millisecond))
+	fmt.Fprintf(c.out, "throughput: %.0f req/s\n", res.Throughput)
+	fmt.Fprintf(c.out, "latency:    p50 %v  p90 %v  p99 %v  max %v\n", res.P50, res.P90, res.P99, res.Max)
+	return nil
+}
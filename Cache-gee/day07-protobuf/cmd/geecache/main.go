@@ -0,0 +1,426 @@
+// geecache 是访问 GeeCache 集群的命令行工具，使用与节点之间相同的 HTTPPool 协议。
+//
+// 用法：
+//
+//	geecache [flags] get <key>
+//	geecache [flags] set [-ttl 1m] <key> <value>
+//	geecache [flags] del <key>
+//	geecache [flags] stats
+//	geecache [flags] ring <key>...
+//	geecache [flags] bench [-n 10000] [-c 16] [-keys 1000]
+//
+// 节点列表通过 -peers 或环境变量 GEECACHE_PEERS 指定，请求签名的密钥从 GEECACHE_SECRET 读取。
+// -replicas、-algo、-hash 和 -weights 必须与集群的 HTTPPool 一致，否则找到的节点不是负责 key 的节点。
+// 管理接口默认位于 <base-path>_admin，访问 geecache-server 单独的管理端口时使用 -admin-path /_admin。
+// 加上 -json 时以 JSON 格式输出，便于脚本处理。
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"geecache"
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// 命令行工具的配置和节点池
+type cli struct {
+	pool    *geecache.HTTPPool
+	peers   []string
+	group   string
+	asJSON  bool
+	timeout time.Duration
+	client  *http.Client
+	secret  []byte
+	out     io.Writer
+	// 管理接口的路径前缀
+	adminPath string
+	verbose   bool
+}
+
+// 命令行参数有误，main 输出用法说明后退出
+var errUsage = errors.New("usage: geecache [flags] get|set|del|stats|ring|bench [args]")
+
+// 哈希算法，与 HTTPPoolOptions.HashFn 对应，不指定时使用节点选择算法的默认值
+var hashes = map[string]consistenthash.Hash{
+	"crc32":  crc32.ChecksumIEEE,
+	"fnv32a": fnv32a,
+}
+
+func fnv32a(data []byte) uint32 {
+	h := fnv.New32a()
+	h.Write(data)
+	return h.Sum32()
+}
+
+// 根据算法名创建节点选择算法，与 HTTPPoolOptions.NewRing 对应。ring 是 HTTPPool 默认的一致性哈希
+func ringFunc(algo string, replicas int, fn consistenthash.Hash) (func() consistenthash.Ring, error) {
+	switch algo {
+	case "ring":
+		return func() consistenthash.Ring { return consistenthash.New(replicas, fn) }, nil
+	case "rendezvous":
+		return func() consistenthash.Ring { return consistenthash.NewRendezvous(fn) }, nil
+	case "jump":
+		return func() consistenthash.Ring { return consistenthash.NewJump(fn) }, nil
+	}
+	return nil, fmt.Errorf("unknown algorithm %q, want ring, rendezvous or jump", algo)
+}
+
+// 解析 addr=weight 形式的权重列表
+func parseWeights(s string) (map[string]int, error) {
+	weights := make(map[string]int)
+	if s == "" {
+		return weights, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		addr, w, _ := strings.Cut(strings.TrimSpace(part), "=")
+		weight, err := strconv.Atoi(w)
+		if addr == "" || err != nil || weight < 1 {
+			return nil, fmt.Errorf("bad weight %q, want addr=weight", part)
+		}
+		weights[addr] = weight
+	}
+	return weights, nil
+}
+
+// 解析全局参数并创建节点池，返回子命令及其参数。错误和用法说明写入 output
+func parseArgs(args []string, output io.Writer) (*cli, []string, error) {
+	var (
+		c                         = &cli{out: os.Stdout, secret: []byte(os.Getenv("GEECACHE_SECRET"))}
+		peers, weights            string
+		basePath, algo, hashName  string
+		certFile, keyFile, caFile string
+		replicas                  int
+	)
+	defaultPeers := os.Getenv("GEECACHE_PEERS")
+	if defaultPeers == "" {
+		defaultPeers = "http://localhost:8001,http://localhost:8002,http://localhost:8003"
+	}
+	fs := flag.NewFlagSet("geecache", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&peers, "peers", defaultPeers, "Comma separated peer addresses, same as the cluster's HTTPPool.Set")
+	fs.StringVar(&c.group, "group", "scores", "Cache group name")
+	fs.BoolVar(&c.asJSON, "json", false, "Print JSON instead of human readable output")
+	fs.DurationVar(&c.timeout, "timeout", 3*time.Second, "Timeout of each request")
+	fs.StringVar(&basePath, "base-path", "/_geecache/", "Base path of peer requests, same as HTTPPoolOptions.BasePath")
+	fs.StringVar(&c.adminPath, "admin-path", "", "Path prefix of the admin API, default <base-path>_admin")
+	fs.IntVar(&replicas, "replicas", 50, "Virtual nodes per peer, must match the cluster")
+	fs.StringVar(&algo, "algo", "ring", "Peer selection algorithm: ring, rendezvous or jump, must match the cluster")
+	fs.StringVar(&hashName, "hash", "", "Hash function: crc32 or fnv32a, default is the algorithm's default, must match the cluster")
+	fs.StringVar(&weights, "weights", "", "Comma separated addr=weight, same as HTTPPool.SetWeight")
+	fs.StringVar(&certFile, "tls-cert", "", "Client TLS certificate (PEM)")
+	fs.StringVar(&keyFile, "tls-key", "", "Client TLS private key (PEM)")
+	fs.StringVar(&caFile, "tls-ca", "", "CA certificate (PEM) for verifying peers")
+	fs.BoolVar(&c.verbose, "v", false, "Log every peer request")
+	fs.Usage = func() {
+		fmt.Fprintln(output, errUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	if fs.NArg() == 0 {
+		return nil, nil, errUsage
+	}
+
+	hashFn, ok := hashes[hashName]
+	if !ok && hashName != "" {
+		return nil, nil, fmt.Errorf("unknown hash %q, want crc32 or fnv32a", hashName)
+	}
+	newRing, err := ringFunc(algo, replicas, hashFn)
+	if err != nil {
+		return nil, nil, err
+	}
+	w, err := parseWeights(weights)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !strings.HasSuffix(basePath, "/") {
+		basePath += "/"
+	}
+	if c.adminPath == "" {
+		c.adminPath = basePath + "_admin"
+	}
+	c.adminPath = strings.TrimSuffix(c.adminPath, "/")
+
+	c.peers = strings.Split(peers, ",")
+	opts := &geecache.HTTPPoolOptions{
+		BasePath: basePath,
+		Replicas: replicas,
+		NewRing:  newRing,
+		Timeout:  c.timeout,
+		Secret:   c.secret,
+	}
+	if certFile != "" {
+		cfg, err := geecache.LoadTLSConfig(certFile, keyFile, caFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts.TLSConfig = cfg
+	}
+	c.pool = geecache.NewHTTPPoolOpts("", opts)
+	c.pool.Set(c.peers...)
+	for addr, weight := range w {
+		if !slices.Contains(c.peers, addr) {
+			return nil, nil, fmt.Errorf("weight for %s, which is not in -peers", addr)
+		}
+		c.pool.SetWeight(addr, weight)
+	}
+	c.client = &http.Client{Timeout: c.timeout}
+	if opts.TLSConfig != nil {
+		c.client.Transport = &http.Transport{TLSClientConfig: opts.TLSConfig}
+	}
+	return c, fs.Args(), nil
+}
+
+func main() {
+	log.SetFlags(0)
+	c, args, err := parseArgs(os.Args[1:], os.Stderr)
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return
+	case errors.Is(err, errUsage):
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	case err != nil:
+		fatal(err)
+	}
+	if !c.verbose {
+		// HTTPPool 会记录每次选择的节点
+		log.SetOutput(io.Discard)
+	}
+	if err := c.run(args); errors.Is(err, errUsage) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	} else if err != nil {
+		fatal(err)
+	}
+}
+
+// 执行子命令
+func (c *cli) run(args []string) error {
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "get":
+		return c.get(args)
+	case "set":
+		return c.set(args)
+	case "del":
+		return c.del(args)
+	case "stats":
+		return c.stats(args)
+	case "ring":
+		return c.ring(args)
+	case "bench":
+		return c.bench(args)
+	}
+	return errUsage
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "geecache:", err)
+	os.Exit(1)
+}
+
+// 输出 JSON
+func (c *cli) printJSON(v interface{}) error {
+	enc := json.NewEncoder(c.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// 检查参数个数
+func needArgs(cmd string, args []string, n int, usage string) error {
+	if len(args) != n {
+		return fmt.Errorf("usage: geecache %s %s", cmd, usage)
+	}
+	return nil
+}
+
+// 本地缓存组只用于 set 和 del 的转发和失效通知，不会从数据源加载
+func (c *cli) newGroup(opts ...geecache.GroupOption) *geecache.Group {
+	g := geecache.NewGroup(c.group, 0, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, errors.New("geecache CLI cannot load values")
+		}), opts...)
+	g.RegisterPeers(c.pool)
+	return g
+}
+
+// 从负责 key 的节点获取缓存值
+func (c *cli) fetch(ctx context.Context, key string) (*pb.Response, error) {
+	peer, ok := c.pool.PickOwner(key)
+	if !ok {
+		return nil, fmt.Errorf("no peer for key %q", key)
+	}
+	res := &pb.Response{}
+	err := peer.Get(ctx, &pb.Request{Group: c.group, Key: key}, res)
+	return res, err
+}
+
+// get 结果
+type getResult struct {
+	Key    string     `json:"key"`
+	Owner  string     `json:"owner"`
+	Found  bool       `json:"found"`
+	Value  string     `json:"value,omitempty"`
+	Expire *time.Time `json:"expire,omitempty"`
+}
+
+func (c *cli) get(args []string) error {
+	if err := needArgs("get", args, 1, "<key>"); err != nil {
+		return err
+	}
+	key := args[0]
+	res, err := c.fetch(context.Background(), key)
+	if err != nil {
+		return err
+	}
+	r := getResult{Key: key, Owner: c.pool.Owner(key), Found: res.Status != pb.Status_NOT_FOUND, Value: string(res.Value)}
+	if res.Expire != 0 {
+		expire := time.Unix(0, res.Expire)
+		r.Expire = &expire
+	}
+	if c.asJSON {
+		return c.printJSON(r)
+	}
+	if !r.Found {
+		return fmt.Errorf("%s: not found (owner %s)", key, r.Owner)
+	}
+	fmt.Fprintln(c.out, r.Value)
+	if r.Expire != nil {
+		fmt.Fprintf(os.Stderr, "owner %s, expires in %v\n", r.Owner, time.Until(*r.Expire).Round(time.Second))
+	}
+	return nil
+}
+
+func (c *cli) set(args []string) error {
+	fs := flag.NewFlagSet("set", flag.ExitOnError)
+	ttl := fs.Duration("ttl", 0, "Time to live, 0 means never expire")
+	fs.Parse(args)
+	if err := needArgs("set", fs.Args(), 2, "[-ttl d] <key> <value>"); err != nil {
+		return err
+	}
+	key, value := fs.Arg(0), fs.Arg(1)
+	if err := c.newGroup(geecache.WithTTL(*ttl)).Set(key, []byte(value)); err != nil {
+		return err
+	}
+	return c.done("set", key)
+}
+
+func (c *cli) del(args []string) error {
+	if err := needArgs("del", args, 1, "<key>"); err != nil {
+		return err
+	}
+	if err := c.newGroup().Remove(args[0]); err != nil {
+		return err
+	}
+	return c.done("del", args[0])
+}
+
+// 输出写操作的结果
+func (c *cli) done(op, key string) error {
+	owner := c.pool.Owner(key)
+	if c.asJSON {
+		return c.printJSON(map[string]string{"op": op, "key": key, "owner": owner})
+	}
+	fmt.Fprintf(c.out, "%s %s: ok (owner %s)\n", op, key, owner)
+	return nil
+}
+
+// 一个节点的统计信息
+type peerStats struct {
+	Peer   string               `json:"peer"`
+	Groups []geecache.GroupInfo `json:"groups,omitempty"`
+	Error  string               `json:"error,omitempty"`
+}
+
+// 通过管理接口获取每个节点上所有缓存组的信息
+func (c *cli) stats(args []string) error {
+	if err := needArgs("stats", args, 0, ""); err != nil {
+		return err
+	}
+	var all []peerStats
+	for _, peer := range c.peers {
+		ps := peerStats{Peer: peer}
+		if err := c.admin(peer, "/groups", &ps.Groups); err != nil {
+			ps.Error = err.Error()
+		}
+		all = append(all, ps)
+	}
+	if c.asJSON {
+		return c.printJSON(all)
+	}
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PEER\tGROUP\tITEMS\tBYTES\tMAX\tGETS\tHIT%\tPEER LOADS\tLOCAL LOADS\tERRORS")
+	for _, ps := range all {
+		if ps.Error != "" {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t-\t-\t-\t-\t-\t%s\n", ps.Peer, ps.Error)
+			continue
+		}
+		for _, g := range ps.Groups {
+			s := g.Stats
+			hit := 0.0
+			if s.Gets > 0 {
+				hit = float64(s.Hits) / float64(s.Gets) * 100
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%.1f\t%d\t%d\t%d\n", ps.Peer, g.Name, g.Items+g.HotItems,
+				g.Bytes+g.HotBytes, g.CacheBytes, s.Gets, hit, s.PeerLoads, s.LocalLoads, s.PeerErrors+s.LocalLoadErrs)
+		}
+	}
+	return w.Flush()
+}
+
+// 请求节点的管理接口，并将返回的 JSON 解码到 out 中
+func (c *cli) admin(peer, path string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(peer, "/")+c.adminPath+path, nil)
+	if err != nil {
+		return err
+	}
+	if len(c.secret) > 0 {
+		geecache.SignRequest(req, c.secret, nil)
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// 显示负责各个 key 的节点
+func (c *cli) ring(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: geecache ring <key>...")
+	}
+	owners := make(map[string]string, len(args))
+	for _, key := range args {
+		owners[key] = c.pool.Owner(key)
+	}
+	if c.asJSON {
+		return c.printJSON(owners)
+	}
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tOWNER")
+	for _, key := range args {
+		fmt.Fprintf(w, "%s\t%s\n", key, owners[key])
+	}
+	return w.Flush()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"geecache"
+	"geecache/consistenthash"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 测试全局参数的解析
+// 测试步骤
+//  1. 正确的参数返回子命令及其参数，管理接口路径默认跟随 -base-path
+//  2. 缺少子命令、未知的算法、哈希和错误的权重返回错误
+func TestParseArgs(t *testing.T) {
+	t.Setenv("GEECACHE_PEERS", "")
+	tests := []struct {
+		name      string
+		args      []string
+		rest      []string
+		adminPath string
+		err       string
+	}{
+		{"default", []string{"get", "Tom"}, []string{"get", "Tom"}, "/_geecache/_admin", ""},
+		{"base path", []string{"-base-path", "/cache", "stats"}, []string{"stats"}, "/cache/_admin", ""},
+		{"admin path", []string{"-admin-path", "/_admin/", "stats"}, []string{"stats"}, "/_admin", ""},
+		{"sub command flags", []string{"-json", "set", "-ttl", "1m", "Tom", "630"}, []string{"set", "-ttl", "1m", "Tom", "630"}, "/_geecache/_admin", ""},
+		{"no command", []string{"-json"}, nil, "", errUsage.Error()},
+		{"unknown algo", []string{"-algo", "maglev", "ring", "Tom"}, nil, "", `unknown algorithm "maglev"`},
+		{"unknown hash", []string{"-hash", "md5", "ring", "Tom"}, nil, "", `unknown hash "md5"`},
+		{"bad weight", []string{"-weights", "http://localhost:8001", "ring", "Tom"}, nil, "", "want addr=weight"},
+		{"weight of unknown peer", []string{"-weights", "http://localhost:9001=2", "ring", "Tom"}, nil, "", "not in -peers"},
+		{"unknown flag", []string{"-unknown", "get", "Tom"}, nil, "", "flag provided but not defined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			c, rest, err := parseArgs(tt.args, &output)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error()+output.String(), tt.err) {
+					t.Fatalf("parseArgs(%q) = %v, want %q", tt.args, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(rest, " ") != strings.Join(tt.rest, " ") || c.adminPath != tt.adminPath {
+				t.Fatalf("parseArgs(%q) = %q, admin path %q", tt.args, rest, c.adminPath)
+			}
+			if got := strings.Join(c.peers, ","); got != "http://localhost:8001,http://localhost:8002,http://localhost:8003" {
+				t.Fatalf("default peers = %s", got)
+			}
+		})
+	}
+	if _, _, err := parseArgs([]string{"-h"}, io.Discard); !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("parseArgs(-h) = %v, want flag.ErrHelp", err)
+	}
+}
+
+// 测试 ring 的输出与使用相同选项的集群一致
+// 测试步骤
+//  1. 集群使用 rendezvous 算法、fnv32a 哈希和不同的权重
+//  2. ring 输出的每个 key 的节点与集群中 HTTPPool.Owner 的结果相同
+//  3. 表格和 JSON 两种格式都输出所有 key
+func TestRing(t *testing.T) {
+	peers := []string{"http://localhost:8001", "http://localhost:8002", "http://localhost:8003"}
+	cluster := geecache.NewHTTPPoolOpts(peers[0], &geecache.HTTPPoolOptions{
+		NewRing: func() consistenthash.Ring { return consistenthash.NewRendezvous(fnv32a) },
+	})
+	cluster.Set(peers...)
+	cluster.SetWeight(peers[1], 3)
+
+	keys := make([]string, 20)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+	for _, asJSON := range []bool{false, true} {
+		args := []string{"-peers", strings.Join(peers, ","), "-algo", "rendezvous", "-hash", "fnv32a",
+			"-weights", peers[1] + "=3", "-json=" + strconv.FormatBool(asJSON), "ring"}
+		c, rest, err := parseArgs(append(args, keys...), io.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		c.out = &out
+		if err := c.run(rest); err != nil {
+			t.Fatal(err)
+		}
+		owners := make(map[string]string)
+		if asJSON {
+			if err := json.Unmarshal(out.Bytes(), &owners); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			if strings.Join(strings.Fields(lines[0]), " ") != "KEY OWNER" {
+				t.Fatalf("unexpected header %q", lines[0])
+			}
+			for _, line := range lines[1:] {
+				f := strings.Fields(line)
+				owners[f[0]] = f[1]
+			}
+		}
+		if len(owners) != len(keys) {
+			t.Fatalf("ring printed %d keys, want %d", len(owners), len(keys))
+		}
+		for _, key := range keys {
+			if want := cluster.Owner(key); owners[key] != want {
+				t.Fatalf("owner of %s = %s, cluster says %s", key, owners[key], want)
+			}
+		}
+	}
+}
+
+// 测试 -admin-path 访问 geecache-server 单独的管理端口
+func TestStatsAdminPath(t *testing.T) {
+	geecache.NewGroup("cli-stats", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) { return []byte(key), nil }))
+	mux := http.NewServeMux()
+	mux.Handle("/_admin/", geecache.NewAdminHandler("/_admin"))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c, rest, err := parseArgs([]string{"-peers", srv.URL, "-admin-path", "/_admin", "-json", "stats"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	c.out = &out
+	if err := c.run(rest); err != nil {
+		t.Fatal(err)
+	}
+	var stats []peerStats
+	if err := json.Unmarshal(out.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].Error != "" || len(stats[0].Groups) == 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
@@ -0,0 +1,125 @@
+// hashdist 统计不同节点选择算法下 key 在各节点上的分布。
+//
+// 用法：
+//
+//	go run ./cmd/hashdist -nodes a,b:2,c -keys 100000
+//
+// 节点可以用 name:weight 的形式指定权重。对每种算法输出各节点分到的 key 数、
+// 实际占比和按权重计算的期望占比，以及删除最后一个节点时迁移的 key 的比例。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"geecache/consistenthash"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+type node struct {
+	name   string
+	weight int
+}
+
+// 解析 name[:weight] 形式的节点列表
+func parseNodes(s string) ([]node, error) {
+	var nodes []node
+	for _, part := range strings.Split(s, ",") {
+		name, w, found := strings.Cut(strings.TrimSpace(part), ":")
+		n := node{name: name, weight: 1}
+		if found {
+			weight, err := strconv.Atoi(w)
+			if err != nil || weight < 1 {
+				return nil, fmt.Errorf("bad weight in %q", part)
+			}
+			n.weight = weight
+		}
+		if n.name == "" {
+			return nil, fmt.Errorf("empty node name in %q", s)
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+// 输出一种算法的分布报告
+func report(w *tabwriter.Writer, algo string, newRing func() consistenthash.Ring, nodes []node, keys int) {
+	ring := newRing()
+	totalWeight := 0
+	for _, n := range nodes {
+		ring.AddWeighted(n.name, n.weight)
+		totalWeight += n.weight
+	}
+	owners := make([]string, keys)
+	counts := make(map[string]int, len(nodes))
+	for i := range owners {
+		owners[i] = ring.Get("key" + strconv.Itoa(i))
+		counts[owners[i]]++
+	}
+
+	fmt.Fprintf(w, "== %s\n", algo)
+	fmt.Fprintln(w, "node\tweight\tkeys\tshare\texpected\t")
+	// 实际 key 数相对期望值的偏差
+	var sq float64
+	for _, n := range nodes {
+		expected := float64(n.weight) / float64(totalWeight)
+		share := float64(counts[n.name]) / float64(keys)
+		dev := (share - expected) / expected
+		sq += dev * dev
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.2f%%\t%.2f%%\t\n", n.name, n.weight, counts[n.name], share*100, expected*100)
+	}
+	fmt.Fprintf(w, "relative stddev: %.2f%%\n", math.Sqrt(sq/float64(len(nodes)))*100)
+
+	if len(nodes) > 1 {
+		last := nodes[len(nodes)-1].name
+		ring.Remove(last)
+		moved := 0
+		for i, owner := range owners {
+			if ring.Get("key"+strconv.Itoa(i)) != owner {
+				moved++
+			}
+		}
+		fmt.Fprintf(w, "moved after removing %s: %.2f%% (owned %.2f%%)\n",
+			last, float64(moved)/float64(keys)*100, float64(counts[last])/float64(keys)*100)
+	}
+	fmt.Fprintln(w)
+}
+
+func main() {
+	var nodeList, algo string
+	var keys, replicas int
+	flag.StringVar(&nodeList, "nodes", "node1,node2,node3,node4", "Comma separated nodes, name[:weight]")
+	flag.IntVar(&keys, "keys", 100000, "Number of keys")
+	flag.IntVar(&replicas, "replicas", 50, "Virtual nodes per weight for the hash ring")
+	flag.StringVar(&algo, "algo", "all", "Algorithm: ring, rendezvous, jump or all")
+	flag.Parse()
+
+	nodes, err := parseNodes(nodeList)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rings := []struct {
+		name    string
+		newRing func() consistenthash.Ring
+	}{
+		{"ring", func() consistenthash.Ring { return consistenthash.New(replicas, nil) }},
+		{"rendezvous", func() consistenthash.Ring { return consistenthash.NewRendezvous(nil) }},
+		{"jump", func() consistenthash.Ring { return consistenthash.NewJump(nil) }},
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	found := false
+	for _, r := range rings {
+		if algo == "all" || algo == r.name {
+			report(w, r.name, r.newRing, nodes, keys)
+			found = true
+		}
+	}
+	w.Flush()
+	if !found {
+		log.Fatalf("unknown algorithm %q", algo)
+	}
+}
@@ -0,0 +1,184 @@
+package geecache
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// 管理接口路径，相对于 basePath
+const defaultAdminPath = "_admin"
+
+// GroupInfo 管理接口返回的缓存组信息
+type GroupInfo struct {
+	Name string `json:"name"`
+	// mainCache 的最大字节数、已用字节数和缓存项数
+	CacheBytes int64 `json:"cacheBytes"`
+	Bytes      int64 `json:"bytes"`
+	Items      int64 `json:"items"`
+	// hotCache 的最大字节数、已用字节数和缓存项数
+	HotCacheBytes int64 `json:"hotCacheBytes"`
+	HotBytes      int64 `json:"hotBytes"`
+	HotItems      int64 `json:"hotItems"`
+	// 磁盘缓存的最大字节数、已用字节数和缓存项数
+	DiskBytes     int64 `json:"diskBytes,omitempty"`
+	DiskUsedBytes int64 `json:"diskUsedBytes,omitempty"`
+	DiskItems     int64 `json:"diskItems,omitempty"`
+	Stats         Stats `json:"stats"`
+}
+
+// KeyInfo 管理接口查看的缓存项
+type KeyInfo struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+	// 过期时间，零值表示永不过期
+	Expire time.Time `json:"expire"`
+	// 所在的本地缓存：main、hot 或 disk
+	Cache string `json:"cache"`
+}
+
+// Name 返回缓存组的名字
+func (g *Group) Name() string {
+	return g.name
+}
+
+// GroupNames 返回所有缓存组的名字，按字母顺序排列
+func GroupNames() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetCacheBytes 修改 mainCache 的最大字节数，0 表示不限制。
+// 缩小时立即按淘汰策略淘汰超出的缓存项，hotCache 的大小不变
+func (g *Group) SetCacheBytes(bytes int64) {
+	g.mainCache.setMaxBytes(bytes)
+}
+
+// Clear 删除本节点上该缓存组的所有缓存值，不通知其他节点
+func (g *Group) Clear() {
+	g.mainCache.clear()
+	if g.hotCache != nil {
+		g.hotCache.clear()
+	}
+	if g.negCache != nil {
+		g.negCache.clear()
+	}
+	if g.disk != nil {
+		g.disk.clear()
+	}
+}
+
+// 返回缓存组的信息
+func (g *Group) info() GroupInfo {
+	main, hot, disk := g.CacheStats(MainCache), g.CacheStats(HotCache), g.CacheStats(DiskCache)
+	return GroupInfo{
+		Name:          g.name,
+		CacheBytes:    main.MaxBytes,
+		Bytes:         main.Bytes,
+		Items:         main.Items,
+		HotCacheBytes: hot.MaxBytes,
+		HotBytes:      hot.Bytes,
+		HotItems:      hot.Items,
+		DiskBytes:     disk.MaxBytes,
+		DiskUsedBytes: disk.Bytes,
+		DiskItems:     disk.Items,
+		Stats:         g.Stats(),
+	}
+}
+
+// 只在本地缓存中查找，不会加载，也不会触发后台刷新
+func (g *Group) peek(key string) (KeyInfo, bool) {
+	info := KeyInfo{Key: key, Cache: "main"}
+	v, ok := g.mainCache.peek(key)
+	if !ok && g.hotCache != nil {
+		info.Cache = "hot"
+		v, ok = g.hotCache.peek(key)
+	}
+	if !ok && g.disk != nil {
+		info.Cache = "disk"
+		v, ok = g.disk.peek(key)
+	}
+	if !ok {
+		return KeyInfo{}, false
+	}
+	info.Value, info.Expire = v.ByteSlice(), v.Expire()
+	return info, true
+}
+
+// NewAdminHandler 创建管理接口，所有路径以 prefix 开头：
+//
+//	GET    <prefix>/groups                    列出所有缓存组及其大小
+//	GET    <prefix>/groups/{group}            查看缓存组
+//	PUT    <prefix>/groups/{group}?bytes=N    修改缓存组的最大字节数
+//	DELETE <prefix>/groups/{group}/keys       清空缓存组
+//	GET    <prefix>/groups/{group}/keys/{key} 查看缓存值，不会触发加载
+//	DELETE <prefix>/groups/{group}/keys/{key} 删除缓存值
+//
+// 所有操作只作用于本节点。HTTPPool 在 <basePath>_admin 下提供该接口，并与其他请求一样校验签名
+func NewAdminHandler(prefix string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+prefix+"/groups", func(w http.ResponseWriter, r *http.Request) {
+		infos := []GroupInfo{}
+		for _, name := range GroupNames() {
+			if g := GetGroup(name); g != nil {
+				infos = append(infos, g.info())
+			}
+		}
+		writeJSON(w, infos)
+	})
+	mux.HandleFunc("GET "+prefix+"/groups/{group}", withGroup(func(w http.ResponseWriter, r *http.Request, g *Group) {
+		writeJSON(w, g.info())
+	}))
+	mux.HandleFunc("PUT "+prefix+"/groups/{group}", withGroup(func(w http.ResponseWriter, r *http.Request, g *Group) {
+		bytes, err := strconv.ParseInt(r.URL.Query().Get("bytes"), 10, 64)
+		if err != nil || bytes < 0 {
+			http.Error(w, "bytes must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		g.SetCacheBytes(bytes)
+		writeJSON(w, g.info())
+	}))
+	mux.HandleFunc("DELETE "+prefix+"/groups/{group}/keys", withGroup(func(w http.ResponseWriter, r *http.Request, g *Group) {
+		g.Clear()
+		writeJSON(w, g.info())
+	}))
+	mux.HandleFunc("GET "+prefix+"/groups/{group}/keys/{key...}", withGroup(func(w http.ResponseWriter, r *http.Request, g *Group) {
+		info, ok := g.peek(r.PathValue("key"))
+		if !ok {
+			http.Error(w, "key not cached", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, info)
+	}))
+	mux.HandleFunc("DELETE "+prefix+"/groups/{group}/keys/{key...}", withGroup(func(w http.ResponseWriter, r *http.Request, g *Group) {
+		g.localRemove(r.PathValue("key"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return mux
+}
+
+// 根据路径中的缓存组名查找缓存组，不存在时返回 404
+func withGroup(fn func(w http.ResponseWriter, r *http.Request, g *Group)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("group")
+		g := GetGroup(name)
+		if g == nil {
+			http.Error(w, "no such group: "+name, http.StatusNotFound)
+			return
+		}
+		fn(w, r, g)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
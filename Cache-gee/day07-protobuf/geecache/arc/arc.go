@@ -0,0 +1,266 @@
+package arc
+
+import (
+	"container/list"
+	"geecache/lru"
+	"time"
+)
+
+// Cache ARC(Adaptive Replacement Cache) 缓存，按字节数计算容量。
+// t1 保存只访问过一次的缓存项，t2 保存访问过多次的缓存项，
+// b1、b2 分别记录最近从 t1、t2 淘汰的 key(幽灵项，不保存缓存值)。
+// 幽灵项命中时调整 t1 的目标大小 p，使缓存在"最近"和"频繁"之间自适应，
+// 一次性的大范围扫描只会冲刷 t1，不会影响 t2 中的热点数据。
+type Cache struct {
+	maxBytes int64
+	// t1 的目标字节数
+	p int64
+
+	t1, t2, b1, b2                     *list.List
+	t1Bytes, t2Bytes, b1Bytes, b2Bytes int64
+
+	// t1、t2 中的缓存项
+	items map[string]*list.Element
+	// b1、b2 中的幽灵项
+	ghosts map[string]*list.Element
+	// 与 lru.Cache 相同的淘汰回调
+	OnEvicted func(key string, value lru.Value, reason lru.EvictReason)
+}
+
+type entry struct {
+	key    string
+	value  lru.Value
+	expire time.Time
+	// 占用的字节数
+	size int64
+	// 所在的链表
+	in *list.List
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
+}
+
+func New(maxBytes int64, onEvicted func(string, lru.Value, lru.EvictReason)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		t1:        list.New(),
+		t2:        list.New(),
+		b1:        list.New(),
+		b2:        list.New(),
+		items:     make(map[string]*list.Element),
+		ghosts:    make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+}
+
+// 返回链表对应的字节计数
+func (c *Cache) bytesOf(l *list.List) *int64 {
+	switch l {
+	case c.t1:
+		return &c.t1Bytes
+	case c.t2:
+		return &c.t2Bytes
+	case c.b1:
+		return &c.b1Bytes
+	}
+	return &c.b2Bytes
+}
+
+// 将元素从所在链表移到 to 链表的头部
+func (c *Cache) moveTo(ele *list.Element, to *list.List) *list.Element {
+	e := ele.Value.(*entry)
+	e.in.Remove(ele)
+	*c.bytesOf(e.in) -= e.size
+	return c.pushTo(e, to)
+}
+
+func (c *Cache) pushTo(e *entry, to *list.List) *list.Element {
+	e.in = to
+	*c.bytesOf(to) += e.size
+	return to.PushFront(e)
+}
+
+func (c *Cache) Get(key string) (value lru.Value, ok bool) {
+	if ele, ok := c.items[key]; ok {
+		e := ele.Value.(*entry)
+		if e.expired(time.Now()) {
+			c.removeItem(ele, lru.EvictExpired)
+			return nil, false
+		}
+		// 再次被访问，进入 t2
+		c.items[key] = c.moveTo(ele, c.t2)
+		return e.value, true
+	}
+	return
+}
+
+// Peek 返回缓存值但不移动到 t2，已过期的缓存项视为不存在但不会被删除
+func (c *Cache) Peek(key string) (value lru.Value, ok bool) {
+	if ele, ok := c.items[key]; ok {
+		if e := ele.Value.(*entry); !e.expired(time.Now()) {
+			return e.value, true
+		}
+	}
+	return
+}
+
+func (c *Cache) Add(key string, value lru.Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire 添加缓存项并指定过期时间，expire 为零值表示永不过期
+func (c *Cache) AddWithExpire(key string, value lru.Value, expire time.Time) {
+	size := int64(len(key) + value.Len())
+	if ele, ok := c.items[key]; ok {
+		e := ele.Value.(*entry)
+		*c.bytesOf(e.in) += size - e.size
+		e.value, e.expire, e.size = value, expire, size
+		c.items[key] = c.moveTo(ele, c.t2)
+		c.evict(false)
+		return
+	}
+
+	e := &entry{key: key, value: value, expire: expire, size: size}
+	inB2 := false
+	if ghost, ok := c.ghosts[key]; ok {
+		g := ghost.Value.(*entry)
+		// 幽灵项命中：b1 命中说明 t1 太小，b2 命中说明 t2 太小
+		if g.in == c.b1 {
+			c.p = min(c.p+size*ratio(c.b2Bytes, c.b1Bytes), c.maxBytes)
+		} else {
+			c.p = max(c.p-size*ratio(c.b1Bytes, c.b2Bytes), 0)
+			inB2 = true
+		}
+		c.removeGhost(ghost)
+		c.items[key] = c.pushTo(e, c.t2)
+	} else {
+		c.items[key] = c.pushTo(e, c.t1)
+	}
+	c.evict(inB2)
+	c.trimGhosts()
+}
+
+// 调整 p 的步长，与对方幽灵链表的相对大小成正比
+func ratio(a, b int64) int64 {
+	if b == 0 || a <= b {
+		return 1
+	}
+	return a / b
+}
+
+// 淘汰缓存项直到不超过最大字节数
+func (c *Cache) evict(inB2 bool) {
+	for c.maxBytes != 0 && c.maxBytes < c.t1Bytes+c.t2Bytes {
+		c.replace(inB2)
+	}
+}
+
+// 根据 p 决定从 t1 还是 t2 淘汰一个缓存项，被淘汰的 key 进入对应的幽灵链表
+func (c *Cache) replace(inB2 bool) {
+	var ele *list.Element
+	var ghost *list.List
+	if c.t1.Len() > 0 && (c.t1Bytes > c.p || (inB2 && c.t1Bytes == c.p) || c.t2.Len() == 0) {
+		ele, ghost = c.t1.Back(), c.b1
+	} else if c.t2.Len() > 0 {
+		ele, ghost = c.t2.Back(), c.b2
+	} else {
+		return
+	}
+	e := ele.Value.(*entry)
+	delete(c.items, e.key)
+	value := e.value
+	e.value = nil
+	c.ghosts[e.key] = c.moveTo(ele, ghost)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, value, lru.EvictCapacity)
+	}
+}
+
+// 限制幽灵链表的大小：t1+b1 不超过容量，全部链表不超过两倍容量
+func (c *Cache) trimGhosts() {
+	for c.b1.Len() > 0 && c.t1Bytes+c.b1Bytes > c.maxBytes {
+		c.removeGhost(c.b1.Back())
+	}
+	for c.b2.Len() > 0 && c.t1Bytes+c.t2Bytes+c.b1Bytes+c.b2Bytes > 2*c.maxBytes {
+		c.removeGhost(c.b2.Back())
+	}
+}
+
+func (c *Cache) removeGhost(ele *list.Element) {
+	e := ele.Value.(*entry)
+	e.in.Remove(ele)
+	*c.bytesOf(e.in) -= e.size
+	delete(c.ghosts, e.key)
+}
+
+func (c *Cache) removeItem(ele *list.Element, reason lru.EvictReason) {
+	e := ele.Value.(*entry)
+	e.in.Remove(ele)
+	*c.bytesOf(e.in) -= e.size
+	delete(c.items, e.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value, reason)
+	}
+}
+
+// RemoveOldest 按 ARC 的替换规则淘汰一个缓存项
+func (c *Cache) RemoveOldest() {
+	c.replace(false)
+}
+
+// SetMaxBytes 修改最大字节数，超出新上限时淘汰缓存项并收缩幽灵链表
+func (c *Cache) SetMaxBytes(maxBytes int64) {
+	c.maxBytes = maxBytes
+	c.p = min(c.p, maxBytes)
+	c.evict(false)
+	c.trimGhosts()
+}
+
+// Remove 主动删除缓存项
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.items[key]; ok {
+		c.removeItem(ele, lru.EvictRemoved)
+	}
+	if ghost, ok := c.ghosts[key]; ok {
+		c.removeGhost(ghost)
+	}
+}
+
+// RemoveExpired 删除所有已过期的缓存项，返回删除的数量
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	n := 0
+	for _, l := range []*list.List{c.t1, c.t2} {
+		for ele := l.Back(); ele != nil; {
+			prev := ele.Prev()
+			if ele.Value.(*entry).expired(now) {
+				c.removeItem(ele, lru.EvictExpired)
+				n++
+			}
+			ele = prev
+		}
+	}
+	return n
+}
+
+// Range 先遍历 t1 再遍历 t2，每个链表从旧到新，fn 返回 false 时停止遍历
+func (c *Cache) Range(fn func(key string, value lru.Value, expire time.Time) bool) {
+	for _, l := range []*list.List{c.t1, c.t2} {
+		for ele := l.Back(); ele != nil; ele = ele.Prev() {
+			e := ele.Value.(*entry)
+			if !fn(e.key, e.value, e.expire) {
+				return
+			}
+		}
+	}
+}
+
+func (c *Cache) Len() int {
+	return c.t1.Len() + c.t2.Len()
+}
+
+// Bytes 返回当前已使用的字节数
+func (c *Cache) Bytes() int64 {
+	return c.t1Bytes + c.t2Bytes
+}
@@ -0,0 +1,81 @@
+package arc
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	arc := New(int64(10), nil)
+	arc.Add("key1", String("1234"))
+	if v, ok := arc.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := arc.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestScanResistant(t *testing.T) {
+	// 测试逻辑
+	// 测试步骤：
+	// 1. 设置缓存容量只能缓存10个缓存项，添加并再次访问h0~h4，使其进入t2
+	// 2. 顺序扫描20个只访问一次的key
+	// 3. 扫描只会冲刷t1，h0~h4仍然命中
+	arc := New(int64(10*4), nil)
+	for i := 0; i < 5; i++ {
+		arc.Add(fmt.Sprintf("h%d", i), String("v1"))
+		arc.Get(fmt.Sprintf("h%d", i))
+	}
+	for i := 0; i < 20; i++ {
+		arc.Add(fmt.Sprintf("s%d", i), String("v1"))
+	}
+	for i := 0; i < 5; i++ {
+		if _, ok := arc.Get(fmt.Sprintf("h%d", i)); !ok {
+			t.Fatalf("hot key h%d flushed by scan", i)
+		}
+	}
+	if arc.Bytes() > 40 {
+		t.Fatalf("cache exceeds maxBytes: %d", arc.Bytes())
+	}
+}
+
+func TestGhostHit(t *testing.T) {
+	// 测试逻辑
+	// 测试步骤：
+	// 1. 设置缓存容量只能缓存两个缓存项，添加并再次访问k0使其进入t2
+	// 2. 添加k1、k2，k1从t1淘汰进入幽灵链表b1
+	// 3. 再次添加k1，b1命中使t1的目标大小p增大，且k1直接进入t2
+	arc := New(int64(8), nil)
+	arc.Add("k0", String("v1"))
+	arc.Get("k0")
+	arc.Add("k1", String("v1"))
+	arc.Add("k2", String("v1"))
+	if _, ok := arc.ghosts["k1"]; !ok || arc.b1.Len() != 1 || arc.p != 0 {
+		t.Fatalf("expect k1 in b1")
+	}
+	arc.Add("k1", String("v1"))
+	if _, ok := arc.Get("k1"); !ok || arc.p == 0 || arc.t2.Len() != 1 {
+		t.Fatalf("ghost hit should adapt p and promote k1 to t2")
+	}
+}
+
+func TestExpire(t *testing.T) {
+	arc := New(int64(0), nil)
+	arc.AddWithExpire("k1", String("v1"), time.Now().Add(-time.Second))
+	arc.Add("k2", String("v2"))
+	if _, ok := arc.Get("k1"); ok {
+		t.Fatalf("expired k1 should miss")
+	}
+	arc.AddWithExpire("k3", String("v3"), time.Now().Add(-time.Second))
+	if n := arc.RemoveExpired(); n != 1 || arc.Len() != 1 || arc.Bytes() != 4 {
+		t.Fatalf("RemoveExpired failed, removed %d, left %d", n, arc.Len())
+	}
+}
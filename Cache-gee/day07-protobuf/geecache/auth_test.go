@@ -0,0 +1,206 @@
+package geecache
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	pb "geecache/geecachepb"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// 生成自签名的 CA 和由它签发的节点证书，写入临时目录，返回证书、私钥和 CA 文件的路径
+func writeTestCerts(t *testing.T) (certFile, keyFile, caFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	write := func(name, typ string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "geecache test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "geecache node"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		// 同一张证书既用于监听端也用于客户端
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leaf, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return write("node.pem", "CERTIFICATE", leafDER), write("node-key.pem", "EC PRIVATE KEY", keyDER), write("ca.pem", "CERTIFICATE", caDER)
+}
+
+// 测试 mTLS 和请求签名
+// 测试步骤
+//  1. 使用相同证书和密钥的节点可以通过 TLS 正常获取缓存值
+//  2. 密钥不同的节点被拒绝
+//  3. 没有客户端证书的连接无法建立
+//  4. 证书正确但没有签名的请求被拒绝，健康检查不需要签名
+func TestHTTPPoolTLS(t *testing.T) {
+	NewGroup("tls", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key + "@tls"), nil
+		}))
+	cfg, err := LoadTLSConfig(writeTestCerts(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("s3cret")
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go NewHTTPPoolOpts("", &HTTPPoolOptions{TLSConfig: cfg, Secret: secret}).Serve(l)
+	addr := "https://" + l.Addr().String()
+
+	peer := NewHTTPPoolOpts("", &HTTPPoolOptions{TLSConfig: cfg, Secret: secret}).newGetter(addr)
+	res := &pb.Response{}
+	if err := peer.Get(context.Background(), &pb.Request{Group: "tls", Key: "Tom"}, res); err != nil || string(res.Value) != "Tom@tls" {
+		t.Fatalf("Get = %q, %v", res.Value, err)
+	}
+
+	stranger := NewHTTPPoolOpts("", &HTTPPoolOptions{TLSConfig: cfg, Secret: []byte("wrong"), Retries: -1}).newGetter(addr)
+	if err := stranger.Get(context.Background(), &pb.Request{Group: "tls", Key: "Tom"}, &pb.Response{}); err == nil {
+		t.Fatalf("request signed with a wrong secret should be rejected")
+	}
+
+	noCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: cfg.RootCAs}}}
+	if res, err := noCert.Get(addr + defaultBasePath + defaultHealthPath); err == nil {
+		res.Body.Close()
+		t.Fatalf("connection without a client certificate should fail")
+	}
+
+	unsigned := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+	res2, err := unsigned.Get(addr + defaultBasePath + "tls/Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res2.Body.Close()
+	if res2.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unsigned request got %v, want 401", res2.Status)
+	}
+	res2, err = unsigned.Get(addr + defaultBasePath + defaultHealthPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res2.Body.Close()
+	if res2.StatusCode != http.StatusOK {
+		t.Fatalf("health check got %v, want 200", res2.Status)
+	}
+}
+
+// 测试签名覆盖请求体和时间戳
+func TestVerifyRequest(t *testing.T) {
+	secret := []byte("s3cret")
+	newReq := func(body string) *http.Request {
+		return httptest.NewRequest(http.MethodPut, defaultBasePath+"scores/Tom", bytes.NewReader([]byte(body)))
+	}
+
+	req := newReq("630")
+	SignRequest(req, secret, []byte("630"))
+	if err := verifyRequest(nil, req, secret, 0); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+
+	tampered := newReq("999")
+	tampered.Header = req.Header.Clone()
+	if err := verifyRequest(nil, tampered, secret, 0); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("tampered body: expect ErrBadSignature, got %v", err)
+	}
+
+	old := newReq("630")
+	ts := strconv.FormatInt(time.Now().Add(-2*signatureMaxSkew).Unix(), 10)
+	old.Header.Set(timestampHeader, ts)
+	old.Header.Set(signatureHeader, signature(secret, old.Method, old.URL.EscapedPath(), "", ts, []byte("630")))
+	if err := verifyRequest(nil, old, secret, 0); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("expired signature: expect ErrBadSignature, got %v", err)
+	}
+}
+
+// 测试签名覆盖查询参数，以及校验签名前的请求体长度限制
+// 测试步骤
+//  1. 签名的成员变更请求可以正常添加节点
+//  2. 截获的请求改写查询参数后重放，返回 401，节点列表不变
+//  3. 超过 MaxValueBytes 的未签名请求体在校验签名前被拒绝，返回 413
+func TestSignedQuery(t *testing.T) {
+	secret := []byte("s3cret")
+	pool := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{Secret: secret, MaxValueBytes: 16})
+	serve := func(req *http.Request) int {
+		w := httptest.NewRecorder()
+		pool.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	req := httptest.NewRequest(http.MethodPost, defaultBasePath+defaultMembersPath+"?peer=http://good", nil)
+	SignRequest(req, secret, nil)
+	if code := serve(req); code != http.StatusOK {
+		t.Fatalf("signed request got %d, want 200", code)
+	}
+
+	replay := httptest.NewRequest(http.MethodPost, defaultBasePath+defaultMembersPath+"?peer=http://evil", nil)
+	replay.Header = req.Header.Clone()
+	if code := serve(replay); code != http.StatusUnauthorized {
+		t.Fatalf("replayed request with a different query got %d, want 401", code)
+	}
+	for _, m := range pool.Members() {
+		if m.Addr == "http://evil" {
+			t.Fatalf("replayed request changed members: %v", pool.Members())
+		}
+	}
+
+	big := httptest.NewRequest(http.MethodPut, defaultBasePath+"scores/Tom", bytes.NewReader(make([]byte, 16+maxResponseOverhead+1)))
+	big.Header.Set(timestampHeader, strconv.FormatInt(time.Now().Unix(), 10))
+	big.Header.Set(signatureHeader, "00")
+	if code := serve(big); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized unsigned body got %d, want 413", code)
+	}
+}
@@ -0,0 +1,346 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "geecache/geecachepb"
+	"log"
+	"sync"
+	"time"
+)
+
+// BatchGetter 可选接口，回调函数一次从数据源加载多个 key。
+// 返回的 map 中没有的 key 视为不存在，与返回 ErrNotFound 相同
+type BatchGetter interface {
+	Getter
+	GetMulti(ctx context.Context, keys []string) (map[string][]byte, error)
+}
+
+// BatchGetterFunc 接口型函数，实现 BatchGetter 接口
+type BatchGetterFunc func(ctx context.Context, keys []string) (map[string][]byte, error)
+
+func (f BatchGetterFunc) Get(key string) ([]byte, error) {
+	return f.get(context.Background(), key)
+}
+
+func (f BatchGetterFunc) GetContext(ctx context.Context, key string) ([]byte, error) {
+	return f.get(ctx, key)
+}
+
+func (f BatchGetterFunc) GetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	return f(ctx, keys)
+}
+
+func (f BatchGetterFunc) get(ctx context.Context, key string) ([]byte, error) {
+	values, err := f(ctx, []string{key})
+	if err != nil {
+		return nil, err
+	}
+	v, ok := values[key]
+	if !ok {
+		return nil, notFound(key)
+	}
+	return v, nil
+}
+
+// 一次批量请求最多包含的 key 数，更多的 key 分成多次请求
+const maxBatchKeys = 1000
+
+// 可选接口，返回远程节点的地址。启用有界负载时每次 PickPeer 都返回新的 PeerGetter，
+// 批量获取时按地址而不是 PeerGetter 分组，同一个节点的 key 仍只发一次请求
+type peerAddresser interface {
+	peerAddr() string
+}
+
+// 可选接口，释放 PickPeer 时占用的资源，例如有界负载的计数
+type peerReleaser interface {
+	release()
+}
+
+// 发往同一个远程节点的 key
+type peerBatch struct {
+	peer PeerGetter
+	keys []string
+	// 每个 key 的 PickPeer 结果，请求结束后全部释放
+	picked []PeerGetter
+}
+
+// GetMulti 批量获取缓存值，返回成功获取的 key 和值。
+// 本地缓存未命中的 key 按负责的远程节点分组，每个节点只发一次批量请求；
+// 由本节点负责的 key 在回调函数实现 BatchGetter 时一次加载。
+// 获取失败的 key 不在返回的 map 中，错误合并后返回
+func (g *Group) GetMulti(ctx context.Context, keys []string) (map[string]ByteView, error) {
+	values, errs, err := g.getMulti(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	var joined []error
+	for _, key := range keys {
+		if e, ok := errs[key]; ok {
+			joined = append(joined, fmt.Errorf("%s: %w", key, e))
+			delete(errs, key)
+		}
+	}
+	return values, errors.Join(joined...)
+}
+
+// 批量获取缓存值，分别返回成功获取的值和每个 key 的错误
+func (g *Group) getMulti(ctx context.Context, keys []string) (map[string]ByteView, map[string]error, error) {
+	values := make(map[string]ByteView, len(keys))
+	errs := make(map[string]error)
+	seen := make(map[string]bool, len(keys))
+	var misses []string
+	for _, key := range keys {
+		if key == "" {
+			return nil, nil, fmt.Errorf("key is required")
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		g.stats.gets.Add(1)
+		if v, ok := g.lookupCache(key); ok {
+			g.stats.hits.Add(1)
+			values[key] = v
+			continue
+		}
+		if g.lookupNotFound(key) {
+			g.stats.negativeHits.Add(1)
+			errs[key] = notFound(key)
+			continue
+		}
+		g.stats.misses.Add(1)
+		misses = append(misses, key)
+	}
+
+	var mu sync.Mutex
+	// 保存一个 key 的结果
+	store := func(key string, v ByteView, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs[key] = err
+			return
+		}
+		values[key] = v
+	}
+
+	local := misses
+	if g.peers != nil && !localOnly(ctx) {
+		local = nil
+		byPeer := make(map[any]*peerBatch)
+		for _, key := range misses {
+			peer, ok := g.peers.PickPeer(key)
+			if !ok {
+				local = append(local, key)
+				continue
+			}
+			var id any = peer
+			if a, ok := peer.(peerAddresser); ok {
+				id = a.peerAddr()
+			}
+			b := byPeer[id]
+			if b == nil {
+				b = &peerBatch{peer: peer}
+				byPeer[id] = b
+			}
+			b.keys = append(b.keys, key)
+			b.picked = append(b.picked, peer)
+		}
+		var wg sync.WaitGroup
+		for _, b := range byPeer {
+			wg.Add(1)
+			go func(b *peerBatch) {
+				defer wg.Done()
+				defer func() {
+					for _, peer := range b.picked {
+						if r, ok := peer.(peerReleaser); ok {
+							r.release()
+						}
+					}
+				}()
+				for _, key := range g.getMultiFromPeer(ctx, b.peer, b.keys, store) {
+					mu.Lock()
+					local = append(local, key)
+					mu.Unlock()
+				}
+			}(b)
+		}
+		wg.Wait()
+	}
+	if len(local) > 0 {
+		g.getMultiLocally(ctx, local, store)
+	}
+	return values, errs, nil
+}
+
+// 从 mainCache 和 hotCache 中查找，mainCache 中的旧值会触发后台刷新
+func (g *Group) lookupCache(key string) (ByteView, bool) {
+	if v, ok := g.mainCache.get(key); ok {
+		if v.stale(time.Now()) {
+			g.stats.staleHits.Add(1)
+			g.refresh(key)
+		}
+		return v, true
+	}
+	if g.hotCache != nil {
+		if v, ok := g.hotCache.get(key); ok {
+			return v, true
+		}
+	}
+	// 从磁盘取回被淘汰的缓存项，放回 mainCache
+	if g.disk != nil {
+		if v, ok := g.disk.take(key); ok {
+			g.stats.diskHits.Add(1)
+			g.mainCache.add(key, v)
+			if v.stale(time.Now()) {
+				g.stats.staleHits.Add(1)
+				g.refresh(key)
+			}
+			return v, true
+		}
+	}
+	return ByteView{}, false
+}
+
+// 从同一个远程节点获取多个 key，返回需要回退到本地加载的 key。
+// 节点不支持批量请求或只有一个 key 时逐个获取
+func (g *Group) getMultiFromPeer(ctx context.Context, peer PeerGetter, keys []string, store func(string, ByteView, error)) (fallback []string) {
+	bp, ok := peer.(BatchPeerGetter)
+	if !ok || len(keys) == 1 {
+		for _, key := range keys {
+			v, err := g.getFromPeer(ctx, peer, key)
+			// 负责该 key 的节点确认不存在，不再回退到本地加载
+			if errors.Is(err, ErrNotFound) {
+				g.stats.peerLoads.Add(1)
+				g.populateNotFound(key)
+				store(key, ByteView{}, err)
+				continue
+			}
+			if err != nil {
+				g.stats.peerErrors.Add(1)
+				log.Println("[GeeCache] Failed to get from peer", err)
+				fallback = append(fallback, key)
+				continue
+			}
+			g.peerLoaded(key, v)
+			store(key, v, nil)
+		}
+		return fallback
+	}
+
+	if len(keys) > maxBatchKeys {
+		fallback = g.getMultiFromPeer(ctx, peer, keys[:maxBatchKeys], store)
+		return append(fallback, g.getMultiFromPeer(ctx, peer, keys[maxBatchKeys:], store)...)
+	}
+	res := &pb.BatchResponse{}
+	if err := bp.GetMulti(ctx, &pb.BatchRequest{Group: g.name, Keys: keys}, res); err != nil {
+		g.stats.peerErrors.Add(1)
+		log.Println("[GeeCache] Failed to get from peer", err)
+		return keys
+	}
+	got := make(map[string]bool, len(res.Entries))
+	for _, e := range res.Entries {
+		got[e.Key] = true
+		if e.Status == pb.Status_NOT_FOUND {
+			g.populateNotFound(e.Key)
+			store(e.Key, ByteView{}, notFound(e.Key))
+			continue
+		}
+		if e.Error != "" {
+			// 远程节点已经尝试过加载，不再回退到本地
+			store(e.Key, ByteView{}, errors.New(e.Error))
+			continue
+		}
+		if err := g.checkSize(e.Key, e.Value); err != nil {
+			store(e.Key, ByteView{}, err)
+			continue
+		}
+		var expire time.Time
+		if e.Expire != 0 {
+			expire = time.Unix(0, e.Expire)
+		}
+		v := ByteView{b: e.Value, e: expire}
+		g.peerLoaded(e.Key, v)
+		store(e.Key, v, nil)
+	}
+	for _, key := range keys {
+		if !got[key] {
+			fallback = append(fallback, key)
+		}
+	}
+	return fallback
+}
+
+// 在本地加载多个 key，回调函数不支持批量加载时逐个并发加载
+func (g *Group) getMultiLocally(ctx context.Context, keys []string, store func(string, ByteView, error)) {
+	bg, ok := g.getter.(BatchGetter)
+	if !ok {
+		var wg sync.WaitGroup
+		for _, key := range keys {
+			wg.Add(1)
+			go func(key string) {
+				defer wg.Done()
+				// 远程节点已经失败过或由本节点负责，不再选择远程节点
+				v, err := g.load(withLocalOnly(ctx), key)
+				store(key, v, err)
+			}(key)
+		}
+		wg.Wait()
+		return
+	}
+
+	values, err := bg.GetMulti(ctx, keys)
+	for _, key := range keys {
+		if err != nil {
+			g.stats.localLoadErrs.Add(1)
+			store(key, ByteView{}, err)
+			continue
+		}
+		b, ok := values[key]
+		if !ok {
+			g.stats.localLoadErrs.Add(1)
+			g.populateNotFound(key)
+			store(key, ByteView{}, notFound(key))
+			continue
+		}
+		if err := g.checkSize(key, b); err != nil {
+			g.stats.localLoadErrs.Add(1)
+			store(key, ByteView{}, err)
+			continue
+		}
+		g.stats.localLoads.Add(1)
+		v := ByteView{b: cloneBytes(b), e: g.expireAt(0)}
+		g.populateCache(key, v)
+		store(key, v, nil)
+	}
+}
+
+// 批量获取缓存值并编码为 BatchResponse，供远程节点的批量请求使用
+func (g *Group) batchResponse(ctx context.Context, keys []string) (*pb.BatchResponse, error) {
+	if len(keys) > maxBatchKeys {
+		return nil, fmt.Errorf("%d keys in one batch, at most %d", len(keys), maxBatchKeys)
+	}
+	values, errs, err := g.getMulti(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	res := &pb.BatchResponse{Entries: make([]*pb.BatchEntry, 0, len(keys))}
+	for _, key := range keys {
+		e := &pb.BatchEntry{Key: key}
+		if v, ok := values[key]; ok {
+			e.Value = v.ByteSlice()
+			if expire := v.Expire(); !expire.IsZero() {
+				e.Expire = expire.UnixNano()
+			}
+		} else if err, ok := errs[key]; ok {
+			e.Error = err.Error()
+			if errors.Is(err, ErrNotFound) {
+				e.Status = pb.Status_NOT_FOUND
+			}
+		}
+		res.Entries = append(res.Entries, e)
+	}
+	return res, nil
+}
@@ -0,0 +1,105 @@
+package geecache
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen 远程节点的熔断器处于打开状态，请求没有发出
+var ErrCircuitOpen = errors.New("geecache: peer circuit breaker is open")
+
+type breakerState int
+
+const (
+	// 正常放行请求
+	breakerClosed breakerState = iota
+	// 连续失败次数达到阈值，冷却期内拒绝所有请求
+	breakerOpen
+	// 冷却期结束，只放行一个试探请求，成功则关闭，失败则重新打开
+	breakerHalfOpen
+)
+
+// breaker 远程节点的熔断器，节点宕机时请求不再等待超时，而是立即失败
+type breaker struct {
+	mu sync.Mutex
+	// 打开熔断器的连续失败次数
+	threshold int
+	// 打开后多久允许试探
+	cooldown time.Duration
+	state    breakerState
+	// 连续失败的次数
+	failures int
+	openedAt time.Time
+	// 半开状态下是否已放行试探请求
+	probing bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// ready 返回熔断器是否可能放行请求，不改变状态，用于选择节点
+func (b *breaker) ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		return time.Since(b.openedAt) >= b.cooldown
+	case breakerHalfOpen:
+		return !b.probing
+	}
+	return true
+}
+
+// allow 判断是否放行请求，冷却期结束后放行的第一个请求作为试探请求
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// success 请求成功，关闭熔断器
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = breakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// abort 请求被调用方取消，不计入成功或失败，只释放试探机会
+func (b *breaker) abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.probing = false
+	}
+}
+
+// failure 请求失败，连续失败达到阈值或试探请求失败时打开熔断器
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+		b.probing = false
+	}
+}
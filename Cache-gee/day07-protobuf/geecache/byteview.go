@@ -1,8 +1,23 @@
 package geecache
 
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrValueTooLarge 缓存值超过了允许的最大长度
+var ErrValueTooLarge = errors.New("geecache: value too large")
+
 // 表示缓存值
 type ByteView struct {
 	b []byte
+	// 过期时间，零值表示永不过期
+	e time.Time
+	// 软过期时间，之后仍可返回但需要在后台重新加载，零值表示不会变旧
+	s time.Time
 }
 
 func (v ByteView) Len() int {
@@ -16,6 +31,56 @@ func (v ByteView) String() string {
 func (v ByteView) ByteSlice() []byte {
 	return cloneBytes(v.b)
 }
+
+// Reader 返回读取缓存值的 Reader，不会复制数据
+func (v ByteView) Reader() io.Reader {
+	return bytes.NewReader(v.b)
+}
+
+// WriteTo 将缓存值写入 w，不会复制数据
+func (v ByteView) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(v.b)
+	return int64(n), err
+}
+
+// ReadByteView 从 r 中读取缓存值。size 为数据长度，未知时传 -1；
+// limit 大于 0 时超过 limit 字节返回 ErrValueTooLarge。
+// 长度已知时只分配一次内存，读到的数据直接作为缓存值，不会再复制
+func ReadByteView(r io.Reader, size, limit int64) (ByteView, error) {
+	if limit > 0 && size > limit {
+		return ByteView{}, fmt.Errorf("%w: %d bytes", ErrValueTooLarge, size)
+	}
+	if size >= 0 {
+		b := make([]byte, size)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return ByteView{}, err
+		}
+		return ByteView{b: b}, nil
+	}
+	if limit > 0 {
+		// 多读一个字节，用来判断是否超过 limit
+		r = io.LimitReader(r, limit+1)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return ByteView{}, err
+	}
+	if limit > 0 && int64(len(b)) > limit {
+		return ByteView{}, fmt.Errorf("%w: more than %d bytes", ErrValueTooLarge, limit)
+	}
+	return ByteView{b: b}, nil
+}
+
+// Expire 返回缓存值的过期时间，零值表示永不过期
+func (v ByteView) Expire() time.Time {
+	return v.e
+}
+
+// 是否已超过软过期时间
+func (v ByteView) stale(now time.Time) bool {
+	return !v.s.IsZero() && !now.Before(v.s)
+}
+
 func cloneBytes(b []byte) []byte {
 	c := make([]byte, len(b))
 	copy(c, b)
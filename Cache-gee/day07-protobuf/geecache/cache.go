@@ -3,35 +3,199 @@ package geecache
 import (
 	"geecache/lru"
 	"sync"
+	"time"
 )
 
-// 嵌套Cache结构体,对其方法进行并发支持
+// 嵌套Policy,对其方法进行并发支持
 type cache struct {
-	mu  sync.Mutex
-	lru *lru.Cache
+	mu     sync.Mutex
+	policy Policy
+	// 创建淘汰策略，为空时使用 LRU
+	newPolicy PolicyFunc
 	// 记录缓存的最大字节数
 	cacheBytes int64
+	// 访问、命中、淘汰次数，由 mu 保护
+	ngets, nhits, nevicts int64
+	// 因容量不足淘汰的缓存项交给 spill，例如写入磁盘缓存，为空时直接丢弃。
+	// spill 在释放 mu 之后调用，磁盘 I/O 不会阻塞同一分片上的其他请求；
+	// 写入前调用 claim，缓存项在此期间被重新写入或删除时 claim 返回 false
+	spill func(key string, value ByteView, claim func() bool)
+	// 已淘汰、尚未交给 spill 的缓存项，由 mu 保护
+	pending map[string]ByteView
+	spilled []cacheEntry
+}
+
+// CacheStats 本地缓存的统计信息
+type CacheStats struct {
+	// 最大字节数，0 表示不限制
+	MaxBytes  int64
+	Bytes     int64
+	Items     int64
+	Gets      int64
+	Hits      int64
+	Evictions int64
 }
 
 // 对底层Add方法进行并发支持
+// 过期时间取自缓存值本身
 func (c *cache) add(key string, value ByteView) {
+	c.mu.Lock()
+	if c.policy == nil {
+		if c.newPolicy == nil {
+			c.newPolicy = LRU
+		}
+		c.policy = c.newPolicy(c.cacheBytes, c.onEvicted)
+	}
+	delete(c.pending, key)
+	c.policy.AddWithExpire(key, value, value.Expire())
+	spilled := c.takeSpilled()
+	c.mu.Unlock()
+	c.flush(spilled)
+}
+
+// 统计因容量不足或过期而被淘汰的缓存项，调用时已持有 mu
+func (c *cache) onEvicted(key string, value lru.Value, reason lru.EvictReason) {
+	if reason != lru.EvictRemoved {
+		c.nevicts++
+	}
+	if reason == lru.EvictCapacity && c.spill != nil {
+		if c.pending == nil {
+			c.pending = make(map[string]ByteView)
+		}
+		c.pending[key] = value.(ByteView)
+		c.spilled = append(c.spilled, cacheEntry{key: key, value: value.(ByteView)})
+	}
+}
+
+// 取出 onEvicted 收集的缓存项，调用时已持有 mu
+func (c *cache) takeSpilled() []cacheEntry {
+	spilled := c.spilled
+	c.spilled = nil
+	return spilled
+}
+
+// 在 mu 之外把淘汰的缓存项交给 spill
+func (c *cache) flush(spilled []cacheEntry) {
+	for _, e := range spilled {
+		c.spill(e.key, e.value, func() bool {
+			return c.claim(e.key, e.value)
+		})
+	}
+}
+
+// 缓存项仍是淘汰时的值、没有被重新写入或删除时返回 true，并将其移出 pending
+func (c *cache) claim(key string, value ByteView) bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+	v, ok := c.pending[key]
+	if !ok || !sameBytes(v.b, value.b) {
+		return false
 	}
-	c.lru.Add(key, value)
+	delete(c.pending, key)
+	return true
 }
 
 // 对底层Get方法进行并发支持
 func (c *cache) get(key string) (value ByteView, ok bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru == nil {
+	c.ngets++
+	if c.policy == nil {
+		return
+	}
+	if v, ok := c.policy.Get(key); ok {
+		c.nhits++
+		return v.(ByteView), true
+	}
+	return
+}
+
+// 查看缓存值，不计入访问次数，也不影响淘汰顺序
+func (c *cache) peek(key string) (value ByteView, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.policy == nil {
 		return
 	}
-	if v, ok := c.lru.Get(key); ok {
+	if v, ok := c.policy.Peek(key); ok {
 		return v.(ByteView), true
 	}
 	return
 }
+
+// 对底层Remove方法进行并发支持
+func (c *cache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, key)
+	if c.policy == nil {
+		return
+	}
+	c.policy.Remove(key)
+}
+
+// 修改最大字节数，超出的缓存项按淘汰策略立即淘汰
+func (c *cache) setMaxBytes(bytes int64) {
+	c.mu.Lock()
+	c.cacheBytes = bytes
+	if c.policy != nil {
+		c.policy.SetMaxBytes(bytes)
+	}
+	spilled := c.takeSpilled()
+	c.mu.Unlock()
+	c.flush(spilled)
+}
+
+// 删除所有缓存项，统计信息保留
+func (c *cache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.policy = nil
+	c.pending = nil
+}
+
+// 清理所有已过期的缓存项，返回清理的数量
+func (c *cache) removeExpired() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.policy == nil {
+		return 0
+	}
+	return c.policy.RemoveExpired()
+}
+
+// 缓存项，用于导出缓存内容
+type cacheEntry struct {
+	key   string
+	value ByteView
+}
+
+// 按淘汰顺序返回所有未过期的缓存项，最先被淘汰的在前
+func (c *cache) entries() []cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.policy == nil {
+		return nil
+	}
+	now := time.Now()
+	entries := make([]cacheEntry, 0, c.policy.Len())
+	c.policy.Range(func(key string, value lru.Value, expire time.Time) bool {
+		if expire.IsZero() || now.Before(expire) {
+			entries = append(entries, cacheEntry{key: key, value: value.(ByteView)})
+		}
+		return true
+	})
+	return entries
+}
+
+// 返回缓存的统计信息
+func (c *cache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := CacheStats{MaxBytes: c.cacheBytes, Gets: c.ngets, Hits: c.nhits, Evictions: c.nevicts}
+	if c.policy != nil {
+		s.Bytes = c.policy.Bytes()
+		s.Items = int64(c.policy.Len())
+	}
+	return s
+}
@@ -0,0 +1,98 @@
+package geecache
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// 测试分片缓存
+// 测试步骤
+//  1. 创建7个分片、总容量100字节的缓存，各分片容量之和应等于100
+//  2. 写入的数据能从对应分片中读出
+func TestShardedCache(t *testing.T) {
+	s := newShardedCache(7, 100, nil)
+	var total int64
+	for _, c := range s.shards {
+		total += c.cacheBytes
+	}
+	if total != 100 {
+		t.Fatalf("shard budgets should sum to 100, got %d", total)
+	}
+	for i := 0; i < 20; i++ {
+		s.add(strconv.Itoa(i), ByteView{b: []byte("v")})
+	}
+	for i := 0; i < 20; i++ {
+		if v, ok := s.get(strconv.Itoa(i)); !ok || v.String() != "v" {
+			t.Fatalf("cache hit %d failed", i)
+		}
+	}
+	if n := s.stats().Items; n != 20 {
+		t.Fatalf("expect 20 entries, got %d", n)
+	}
+}
+
+// 测试容量小于分片数的缓存
+// 测试步骤
+//  1. 10 字节的缓存分成 16 个分片，每个分片至少 1 字节，不会有不限制容量的分片
+//  2. 写入 100 个缓存项后总字节数不超过各分片上限之和
+//  3. 容量小于 8 字节的缓存组，hotCache 和 negCache 同样有上限
+func TestShardedCacheSmall(t *testing.T) {
+	s := newShardedCache(16, 10, nil)
+	var total int64
+	for _, c := range s.shards {
+		if c.cacheBytes <= 0 {
+			t.Fatalf("shard got unlimited budget %d", c.cacheBytes)
+		}
+		total += c.cacheBytes
+	}
+	for i := 0; i < 100; i++ {
+		s.add(strconv.Itoa(i), ByteView{b: []byte("v")})
+	}
+	if n := s.stats().Bytes; n > total {
+		t.Fatalf("cache holds %d bytes, budget %d", n, total)
+	}
+	s.setMaxBytes(3)
+	for _, c := range s.shards {
+		if c.cacheBytes <= 0 {
+			t.Fatalf("shard got unlimited budget %d after resize", c.cacheBytes)
+		}
+	}
+
+	gee := NewGroup("tiny", 4, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithShards(4), WithNegativeTTL(time.Minute))
+	for _, which := range []CacheType{MainCache, HotCache} {
+		if max := gee.CacheStats(which).MaxBytes; max <= 0 {
+			t.Fatalf("cache %d of a 4-byte group is unlimited: %d", which, max)
+		}
+	}
+	if max := gee.negCache.stats().MaxBytes; max <= 0 {
+		t.Fatalf("negative cache of a 4-byte group is unlimited: %d", max)
+	}
+}
+
+// 并发读取已缓存数据的性能，shards-1 即原先单锁的实现
+// 运行命令 go test -bench=CacheParallelGet -cpu=1,4,16
+func BenchmarkCacheParallelGet(b *testing.B) {
+	for _, n := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("shards-%d", n), func(b *testing.B) {
+			s := newShardedCache(n, 0, nil)
+			keys := make([]string, 1024)
+			for i := range keys {
+				keys[i] = strconv.Itoa(i)
+				s.add(keys[i], ByteView{b: []byte("value")})
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					s.get(keys[i%len(keys)])
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package consistenthash
+
+import (
+	"math"
+	"sort"
+)
+
+// BoundedRing 支持有界负载的节点选择算法(Consistent Hashing with Bounded Loads,
+// Mirrokni 等, 2016)。调用方在发出请求前用 Inc 增加节点的负载，请求结束后调用 Done
+type BoundedRing interface {
+	Ring
+	// 返回 key 所属的节点，节点负载已满时顺着哈希环交给下一个未满的节点
+	GetLeast(key string) string
+	// 节点开始处理一个请求
+	Inc(node string)
+	// 节点处理完一个请求
+	Done(node string)
+}
+
+var _ BoundedRing = (*Map)(nil)
+
+// NewBounded 创建启用有界负载的哈希环，
+// 每个节点正在处理的请求数不超过平均值的 1+epsilon 倍(按权重折算)
+func NewBounded(replicas int, epsilon float64, fn Hash) *Map {
+	m := New(replicas, fn)
+	m.epsilon = epsilon
+	return m
+}
+
+// MaxLoad 返回再增加一个请求后节点允许的最大负载：
+// ceil((1+ε) * (totalLoad+1) * weight / 总权重)
+func (m *Map) MaxLoad(node string) int64 {
+	if m.totalWeight == 0 {
+		return 0
+	}
+	avg := float64(m.totalLoad+1) * float64(m.weights[node]) / float64(m.totalWeight)
+	return int64(math.Ceil(avg * (1 + m.epsilon)))
+}
+
+func (m *Map) GetLeast(key string) string {
+	if len(m.keys) == 0 {
+		return ""
+	}
+	hash := int(m.hash([]byte(key)))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	// 总负载不超过各节点上限之和，最多绕环一圈一定能找到未满的节点
+	for i := 0; i < len(m.keys); i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if m.loads[node]+1 <= m.MaxLoad(node) {
+			return node
+		}
+	}
+	return m.hashMap[m.keys[idx%len(m.keys)]]
+}
+
+func (m *Map) Inc(node string) {
+	if _, ok := m.weights[node]; ok {
+		m.loads[node]++
+		m.totalLoad++
+	}
+}
+
+func (m *Map) Done(node string) {
+	// 节点在请求期间可能已被删除
+	if m.loads[node] > 0 {
+		m.loads[node]--
+		m.totalLoad--
+	}
+}
+
+// Load 返回节点正在处理的请求数
+func (m *Map) Load(node string) int64 {
+	return m.loads[node]
+}
@@ -2,12 +2,31 @@ package consistenthash
 
 import (
 	"hash/crc32"
+	"hash/fnv"
 	"sort"
 	"strconv"
 )
 
 type Hash func(data []byte) uint32
 
+// Ring 根据 key 选择节点的算法，Map、Rendezvous、Jump 都实现了该接口
+type Ring interface {
+	// 添加权重为 1 的节点
+	Add(keys ...string)
+	// 添加节点并指定权重，权重越大分到的 key 越多
+	AddWeighted(key string, weight int)
+	// 删除节点
+	Remove(keys ...string)
+	// 返回 key 所属的节点，没有节点时返回空字符串
+	Get(key string) string
+}
+
+var (
+	_ Ring = (*Map)(nil)
+	_ Ring = (*Rendezvous)(nil)
+	_ Ring = (*Jump)(nil)
+)
+
 type Map struct {
 	//hash算法
 	hash Hash
@@ -17,6 +36,15 @@ type Map struct {
 	keys []int
 	// 虚拟节点hash值与真实节点的映射
 	hashMap map[int]string
+	// 真实节点的权重，节点的虚拟节点数为 replicas*weight
+	weights map[string]int
+	// 所有节点的权重之和
+	totalWeight int
+	// 有界负载的参数 ε，节点负载上限是平均负载的 1+ε 倍
+	epsilon float64
+	// 各节点正在处理的请求数及其总和
+	loads     map[string]int64
+	totalLoad int64
 }
 
 func New(replicas int, fn Hash) *Map {
@@ -24,6 +52,8 @@ func New(replicas int, fn Hash) *Map {
 		replicas: replicas,
 		hash:     fn,
 		hashMap:  make(map[int]string),
+		weights:  make(map[string]int),
+		loads:    make(map[string]int64),
 	}
 	if m.hash == nil {
 		m.hash = crc32.ChecksumIEEE
@@ -34,15 +64,54 @@ func New(replicas int, fn Hash) *Map {
 // 添加虚拟节点进入匹配环，增加虚拟节点hash值与真实节点映射
 func (m *Map) Add(keys ...string) {
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
-			// 这个函数是通过将key和一个从0开始递增的整数i拼接成一个新的字符串，
-			// 然后对该字符串进行哈希计算，最终得到一个整数hash的值。
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = key
+		m.AddWeighted(key, 1)
+	}
+}
+
+// AddWeighted 添加权重为 weight 的节点，节点的虚拟节点数是 replicas 的 weight 倍
+func (m *Map) AddWeighted(key string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	if _, ok := m.weights[key]; ok {
+		m.Remove(key)
+	}
+	m.weights[key] = weight
+	m.totalWeight += weight
+	for i := 0; i < m.replicas*weight; i++ {
+		// 这个函数是通过将key和一个从0开始递增的整数i拼接成一个新的字符串，
+		// 然后对该字符串进行哈希计算，最终得到一个整数hash的值。
+		hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+		m.keys = append(m.keys, hash)
+		m.hashMap[hash] = key
+	}
+	// 升序排序
+	sort.Ints(m.keys)
+}
+
+// Remove 删除节点及其所有虚拟节点
+func (m *Map) Remove(keys ...string) {
+	for _, key := range keys {
+		if _, ok := m.weights[key]; !ok {
+			continue
 		}
-		// 升序排序
-		sort.Ints(m.keys)
+		m.totalWeight -= m.weights[key]
+		delete(m.weights, key)
+		m.totalLoad -= m.loads[key]
+		delete(m.loads, key)
+		for hash, node := range m.hashMap {
+			if node == key {
+				delete(m.hashMap, hash)
+			}
+		}
+		// 保留仍有映射的虚拟节点，原地过滤后仍然有序
+		kept := m.keys[:0]
+		for _, hash := range m.keys {
+			if _, ok := m.hashMap[hash]; ok {
+				kept = append(kept, hash)
+			}
+		}
+		m.keys = kept
 	}
 }
 func (m *Map) Get(key string) string {
@@ -63,3 +132,18 @@ func (m *Map) Get(key string) string {
 	//则取第一个节点
 	return m.hashMap[m.keys[idx%len(m.keys)]]
 }
+
+// mixHash Rendezvous 和 Jump 默认的哈希算法。
+// 用 FNV-1a 计算后再经过 murmur3 的终结函数打散，
+// 避免 crc32 这类线性哈希在拼接相似字符串时得分相关
+func mixHash(data []byte) uint32 {
+	h := fnv.New32a()
+	h.Write(data)
+	x := h.Sum32()
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+	return x
+}
@@ -1,6 +1,8 @@
 package consistenthash
 
 import (
+	"fmt"
+	"math"
 	"strconv"
 	"testing"
 )
@@ -39,3 +41,123 @@ func TestHashing(t *testing.T) {
 		}
 	}
 }
+
+func TestRemove(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	// 虚拟节点分布 2, 4, 6, 12, 14, 16, 22, 24, 26
+	hash.Add("6", "4", "2")
+	// 删除节点 2 后虚拟节点分布 4, 6, 14, 16, 24, 26
+	hash.Remove("2")
+	testCases := map[string]string{
+		"2":  "4",
+		"11": "4",
+		"23": "4",
+		"27": "4",
+	}
+	for key, value := range testCases {
+		if hash.Get(key) != value {
+			t.Errorf("Asking for %s, expected %s, got %s", key, value, hash.Get(key))
+		}
+	}
+	hash.Remove("4", "6")
+	if v := hash.Get("2"); v != "" {
+		t.Errorf("empty ring should return empty node, got %s", v)
+	}
+}
+
+// 统计 n 个 key 在各节点上的分布
+func distribution(r Ring, n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		counts[r.Get(fmt.Sprintf("key%d", i))]++
+	}
+	return counts
+}
+
+// 测试所有算法的均衡性、权重和删除节点时的迁移量
+// 测试步骤
+//  1. 4 个节点中 a 的权重为 2，a 分到的 key 约为其他节点的 2 倍
+//  2. 删除最后加入的节点 d，只有原本属于 d 的 key 迁移
+func TestRings(t *testing.T) {
+	rings := map[string]func() Ring{
+		"map":        func() Ring { return New(100, nil) },
+		"rendezvous": func() Ring { return NewRendezvous(nil) },
+		"jump":       func() Ring { return NewJump(nil) },
+	}
+	const n = 50000
+	for name, newRing := range rings {
+		t.Run(name, func(t *testing.T) {
+			r := newRing()
+			r.AddWeighted("a", 2)
+			r.Add("b", "c", "d")
+			counts := distribution(r, n)
+			// 权重合计为 5，每份约 n/5
+			for node, weight := range map[string]int{"a": 2, "b": 1, "c": 1, "d": 1} {
+				want := n / 5 * weight
+				if got := counts[node]; got < want*3/4 || got > want*5/4 {
+					t.Errorf("node %s got %d keys, want about %d", node, got, want)
+				}
+			}
+
+			before := make([]string, n)
+			for i := range before {
+				before[i] = r.Get(fmt.Sprintf("key%d", i))
+			}
+			r.Remove("d")
+			for i, old := range before {
+				now := r.Get(fmt.Sprintf("key%d", i))
+				if now == "d" || (old != "d" && now != old) {
+					t.Fatalf("key%d moved from %s to %s", i, old, now)
+				}
+			}
+		})
+	}
+}
+
+// 测试有界负载
+// 测试步骤
+//  1. 90% 的请求是同一个热点 key，请求全部未结束
+//  2. 每次分配后所有节点的负载都不超过 ceil((1+ε)*平均负载)
+//  3. 负载未满时 key 仍由哈希环上的负责节点处理，请求结束后负载归零
+func TestBoundedLoad(t *testing.T) {
+	const epsilon = 0.25
+	m := NewBounded(50, epsilon, nil)
+	nodes := []string{"a", "b", "c", "d"}
+	m.Add(nodes...)
+	if owner, least := m.Get("hot"), m.GetLeast("hot"); owner != least {
+		t.Fatalf("idle ring should pick the owner %s, got %s", owner, least)
+	}
+
+	var picked []string
+	for i := 0; i < 1000; i++ {
+		key := "hot"
+		if i%10 == 0 {
+			key = fmt.Sprintf("key%d", i)
+		}
+		node := m.GetLeast(key)
+		m.Inc(node)
+		picked = append(picked, node)
+
+		bound := int64(math.Ceil((1 + epsilon) * float64(i+1) / float64(len(nodes))))
+		for _, n := range nodes {
+			if m.Load(n) > bound {
+				t.Fatalf("after %d requests node %s has load %d, bound %d", i+1, n, m.Load(n), bound)
+			}
+		}
+	}
+
+	for _, node := range picked {
+		m.Done(node)
+	}
+	for _, n := range nodes {
+		if m.Load(n) != 0 {
+			t.Fatalf("node %s has load %d after all requests are done", n, m.Load(n))
+		}
+	}
+	if owner, least := m.Get("hot"), m.GetLeast("hot"); owner != least {
+		t.Fatalf("idle ring should pick the owner %s again, got %s", owner, least)
+	}
+}
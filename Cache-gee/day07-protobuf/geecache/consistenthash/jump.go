@@ -0,0 +1,74 @@
+package consistenthash
+
+// Jump Google 的跳跃一致性哈希(Lamping & Veach, 2014)。
+// 把 key 映射到 [0, n) 的桶，不需要保存哈希环，内存占用小且分布均匀。
+// 桶只能在末尾增删：在末尾增加节点时只有 1/n 的 key 迁移，
+// 删除中间的节点会使之后的桶整体前移，迁移的 key 更多
+type Jump struct {
+	hash Hash
+	// 按加入顺序排列的桶，权重为 w 的节点占 w 个桶
+	buckets []string
+	// 节点的权重
+	weights map[string]int
+}
+
+func NewJump(fn Hash) *Jump {
+	j := &Jump{hash: fn, weights: make(map[string]int)}
+	if j.hash == nil {
+		j.hash = mixHash
+	}
+	return j
+}
+
+func (j *Jump) Add(keys ...string) {
+	for _, key := range keys {
+		j.AddWeighted(key, 1)
+	}
+}
+
+func (j *Jump) AddWeighted(key string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	if _, ok := j.weights[key]; ok {
+		j.Remove(key)
+	}
+	j.weights[key] = weight
+	for i := 0; i < weight; i++ {
+		j.buckets = append(j.buckets, key)
+	}
+}
+
+func (j *Jump) Remove(keys ...string) {
+	for _, key := range keys {
+		if _, ok := j.weights[key]; !ok {
+			continue
+		}
+		delete(j.weights, key)
+		kept := j.buckets[:0]
+		for _, node := range j.buckets {
+			if node != key {
+				kept = append(kept, node)
+			}
+		}
+		j.buckets = kept
+	}
+}
+
+func (j *Jump) Get(key string) string {
+	if len(j.buckets) == 0 {
+		return ""
+	}
+	return j.buckets[JumpHash(uint64(j.hash([]byte(key))), len(j.buckets))]
+}
+
+// JumpHash 将 key 映射到 [0, buckets) 中的一个桶
+func JumpHash(key uint64, buckets int) int {
+	var b, i int64 = -1, 0
+	for i < int64(buckets) {
+		b = i
+		key = key*2862933555777941757 + 1
+		i = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
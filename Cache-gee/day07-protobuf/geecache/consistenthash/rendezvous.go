@@ -0,0 +1,70 @@
+package consistenthash
+
+import (
+	"math"
+	"sort"
+)
+
+// Rendezvous 最高随机权重(HRW)哈希。
+// 对每个节点计算 hash(节点+key) 的得分，得分最高的节点负责该 key。
+// 不需要虚拟节点，删除节点时只有原本属于它的 key 会迁移，
+// 代价是每次查询需要遍历所有节点
+type Rendezvous struct {
+	hash Hash
+	// 按名称排序的节点，得分相同时取靠前的节点
+	nodes []string
+	// 节点的权重
+	weights map[string]int
+}
+
+func NewRendezvous(fn Hash) *Rendezvous {
+	r := &Rendezvous{hash: fn, weights: make(map[string]int)}
+	if r.hash == nil {
+		r.hash = mixHash
+	}
+	return r
+}
+
+func (r *Rendezvous) Add(keys ...string) {
+	for _, key := range keys {
+		r.AddWeighted(key, 1)
+	}
+}
+
+func (r *Rendezvous) AddWeighted(key string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	if _, ok := r.weights[key]; !ok {
+		r.nodes = append(r.nodes, key)
+		sort.Strings(r.nodes)
+	}
+	r.weights[key] = weight
+}
+
+func (r *Rendezvous) Remove(keys ...string) {
+	for _, key := range keys {
+		if _, ok := r.weights[key]; !ok {
+			continue
+		}
+		delete(r.weights, key)
+		i := sort.SearchStrings(r.nodes, key)
+		r.nodes = append(r.nodes[:i], r.nodes[i+1:]...)
+	}
+}
+
+func (r *Rendezvous) Get(key string) string {
+	var best string
+	bestScore := math.Inf(-1)
+	for _, node := range r.nodes {
+		h := r.hash([]byte(node + key))
+		// 加权 HRW：把哈希值映射到 (0,1) 上的 u，得分为 -weight/ln(u)，
+		// 节点分到的 key 的比例与权重成正比
+		u := (float64(h) + 0.5) / (math.MaxUint32 + 1)
+		score := -float64(r.weights[node]) / math.Log(u)
+		if score > bestScore {
+			best, bestScore = node, score
+		}
+	}
+	return best
+}
@@ -0,0 +1,312 @@
+package geecache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"geecache/lru"
+	"hash/crc32"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 磁盘缓存中每条记录的格式：
+//
+//	crc32 | keyLen uint32 | valueLen uint32 | expire int64 | soft int64 | key | value
+//
+// 整数均为大端序，crc32 覆盖其后的全部内容，过期时间为 UnixNano，0 表示没有
+const diskHeaderSize = 4 + 4 + 4 + 8 + 8
+
+// 垃圾数据超过文件的一半且超过该大小时整理文件
+const defaultCompactMin = 1 << 20
+
+// DiskTier 磁盘上的二级缓存。mainCache 因容量不足淘汰的缓存项写入磁盘，
+// mainCache 和 hotCache 都未命中时先查找磁盘，命中后放回 mainCache，
+// 不必再请求远程节点或回调函数。
+//
+// 数据追加写入同一个文件，索引在内存中，按 LRU 淘汰，总大小不超过 maxBytes。
+// 被淘汰或删除的记录成为垃圾数据，超过文件大小的一半时重写文件。
+// 每次打开都从空文件开始，Close 时删除文件
+type DiskTier struct {
+	mu  sync.Mutex
+	dir string
+	// 数据文件的路径，整理后新文件重命名为该路径
+	path string
+	file *os.File
+	// 文件末尾，下一条记录写入的位置
+	end int64
+	// 已失效的记录占用的字节数
+	garbage    int64
+	compactMin int64
+	// 有效记录的总字节数上限，0 表示不限制
+	maxBytes int64
+	// 内存中的索引，值为 *diskEntry
+	index *lru.Cache
+	// 访问、命中、淘汰次数
+	ngets, nhits, nevicts int64
+}
+
+// 一条记录在文件中的位置
+type diskEntry struct {
+	off    int64
+	size   int64
+	keyLen int
+}
+
+// 与 key 的长度合计为记录的大小
+func (e *diskEntry) Len() int {
+	return int(e.size) - e.keyLen
+}
+
+// OpenDiskTier 在 dir 中创建磁盘缓存，maxBytes 为记录的总字节数上限，0 表示不限制。
+// 通过 WithDiskTier 交给缓存组使用，一个 DiskTier 只能用于一个缓存组
+func OpenDiskTier(dir string, maxBytes int64) (*DiskTier, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(dir, "geecache-*.l2")
+	if err != nil {
+		return nil, err
+	}
+	d := &DiskTier{dir: dir, path: f.Name(), file: f, compactMin: defaultCompactMin, maxBytes: maxBytes}
+	d.index = lru.New(maxBytes, d.onEvicted)
+	return d, nil
+}
+
+// 索引中的记录被移除后，其占用的空间成为垃圾数据，调用时已持有 mu
+func (d *DiskTier) onEvicted(key string, value lru.Value, reason lru.EvictReason) {
+	d.garbage += value.(*diskEntry).size
+	if reason != lru.EvictRemoved {
+		d.nevicts++
+	}
+}
+
+// 写入一条记录，同一个 key 的旧记录失效。claim 在持有 mu 时调用，返回 false 时不写入，
+// 之后的 remove 一定在写入完成后执行，被删除的缓存项不会重新出现在磁盘上
+func (d *DiskTier) put(key string, value ByteView, claim func() bool) {
+	size := int64(diskHeaderSize + len(key) + len(value.b))
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.file == nil || (claim != nil && !claim()) {
+		return
+	}
+	d.index.Remove(key)
+	if d.maxBytes > 0 && size > d.maxBytes {
+		return
+	}
+	rec := make([]byte, size)
+	binary.BigEndian.PutUint32(rec[4:], uint32(len(key)))
+	binary.BigEndian.PutUint32(rec[8:], uint32(len(value.b)))
+	binary.BigEndian.PutUint64(rec[12:], uint64(unixNano(value.e)))
+	binary.BigEndian.PutUint64(rec[20:], uint64(unixNano(value.s)))
+	copy(rec[diskHeaderSize:], key)
+	copy(rec[diskHeaderSize+len(key):], value.b)
+	binary.BigEndian.PutUint32(rec, crc32.ChecksumIEEE(rec[4:]))
+	if _, err := d.file.WriteAt(rec, d.end); err != nil {
+		log.Printf("[GeeCache] disk tier write %s: %v", key, err)
+		return
+	}
+	d.index.AddWithExpire(key, &diskEntry{off: d.end, size: size, keyLen: len(key)}, value.e)
+	d.end += size
+	if d.garbage > d.compactMin && d.garbage > d.end/2 {
+		if err := d.compact(); err != nil {
+			log.Printf("[GeeCache] disk tier compaction: %v", err)
+		}
+	}
+}
+
+// 取出 key 对应的缓存值并从磁盘中删除，缓存值将放回 mainCache，之后再被淘汰时重新写入
+func (d *DiskTier) take(key string) (ByteView, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ngets++
+	if d.file == nil {
+		return ByteView{}, false
+	}
+	v, ok := d.index.Get(key)
+	if !ok {
+		return ByteView{}, false
+	}
+	d.index.Remove(key)
+	view, ok := d.read(key, v.(*diskEntry))
+	if ok {
+		d.nhits++
+	}
+	return view, ok
+}
+
+// 查看 key 对应的缓存值，不删除记录，也不计入访问次数和调整淘汰顺序
+func (d *DiskTier) peek(key string) (ByteView, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.file == nil {
+		return ByteView{}, false
+	}
+	v, ok := d.index.Peek(key)
+	if !ok {
+		return ByteView{}, false
+	}
+	return d.read(key, v.(*diskEntry))
+}
+
+// 读取并校验一条记录，调用时已持有 mu
+func (d *DiskTier) read(key string, e *diskEntry) (ByteView, bool) {
+	rec := make([]byte, e.size)
+	if _, err := d.file.ReadAt(rec, e.off); err != nil {
+		log.Printf("[GeeCache] disk tier read %s: %v", key, err)
+		return ByteView{}, false
+	}
+	keyLen := int(binary.BigEndian.Uint32(rec[4:]))
+	if binary.BigEndian.Uint32(rec) != crc32.ChecksumIEEE(rec[4:]) ||
+		keyLen != len(key) || string(rec[diskHeaderSize:diskHeaderSize+keyLen]) != key {
+		log.Printf("[GeeCache] disk tier: corrupted record for %s", key)
+		return ByteView{}, false
+	}
+	// 记录是新分配的内存，直接作为缓存值
+	return ByteView{
+		b: rec[diskHeaderSize+keyLen:],
+		e: fromUnixNano(int64(binary.BigEndian.Uint64(rec[12:]))),
+		s: fromUnixNano(int64(binary.BigEndian.Uint64(rec[20:]))),
+	}, true
+}
+
+// 删除 key 的记录，缓存值被修改或删除时调用
+func (d *DiskTier) remove(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.index.Remove(key)
+}
+
+// 清理已过期的记录
+func (d *DiskTier) removeExpired() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.index.RemoveExpired()
+}
+
+// 删除所有记录
+func (d *DiskTier) clear() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var keys []string
+	d.index.Range(func(key string, value lru.Value, expire time.Time) bool {
+		keys = append(keys, key)
+		return true
+	})
+	for _, key := range keys {
+		d.index.Remove(key)
+	}
+	if d.file != nil {
+		if err := d.compact(); err != nil {
+			log.Printf("[GeeCache] disk tier compaction: %v", err)
+		}
+	}
+}
+
+// Compact 立即重写文件，只保留有效的记录
+func (d *DiskTier) Compact() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.file == nil {
+		return os.ErrClosed
+	}
+	return d.compact()
+}
+
+// 将有效的记录依次复制到新文件，再替换旧文件，调用时已持有 mu
+func (d *DiskTier) compact() error {
+	tmp, err := os.CreateTemp(d.dir, filepath.Base(d.path)+".compact-*")
+	if err != nil {
+		return err
+	}
+	var (
+		entries []*diskEntry
+		offsets []int64
+		end     int64
+	)
+	d.index.Range(func(key string, value lru.Value, expire time.Time) bool {
+		e := value.(*diskEntry)
+		buf := make([]byte, e.size)
+		if _, err = d.file.ReadAt(buf, e.off); err == nil {
+			_, err = tmp.WriteAt(buf, end)
+		}
+		entries, offsets = append(entries, e), append(offsets, end)
+		end += e.size
+		return err == nil
+	})
+	if err == nil {
+		err = os.Rename(tmp.Name(), d.path)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	// 全部复制成功后才修改索引中的位置
+	for i, e := range entries {
+		e.off = offsets[i]
+	}
+	d.file.Close()
+	d.file, d.end, d.garbage = tmp, end, 0
+	return nil
+}
+
+// Stats 返回磁盘缓存的统计信息，Bytes 为有效记录的字节数
+func (d *DiskTier) Stats() CacheStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return CacheStats{
+		MaxBytes:  d.maxBytes,
+		Bytes:     d.index.Bytes(),
+		Items:     int64(d.index.Len()),
+		Gets:      d.ngets,
+		Hits:      d.nhits,
+		Evictions: d.nevicts,
+	}
+}
+
+// Path 返回数据文件的路径
+func (d *DiskTier) Path() string {
+	return d.path
+}
+
+// FileSize 返回文件当前的大小，包括尚未整理的垃圾数据
+func (d *DiskTier) FileSize() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.end
+}
+
+// Close 关闭并删除文件，之后缓存组不再使用磁盘缓存
+func (d *DiskTier) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.file == nil {
+		return nil
+	}
+	err := d.file.Close()
+	d.file = nil
+	if rmErr := os.Remove(d.path); err == nil {
+		err = rmErr
+	}
+	if err != nil {
+		return fmt.Errorf("close disk tier: %w", err)
+	}
+	return nil
+}
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
@@ -0,0 +1,202 @@
+package geecache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试磁盘缓存
+// 测试步骤
+//  1. mainCache 只能放下少量缓存项，依次获取 20 个 key，被淘汰的写入磁盘
+//  2. 再次获取全部 key，都从磁盘取回，不再调用回调函数
+//  3. 管理接口的 peek 能看到磁盘上的缓存项，且不会取出
+//  4. Set 和 Remove 之后磁盘上的旧值失效
+//  5. Clear 清空磁盘缓存
+func TestDiskTier(t *testing.T) {
+	disk, err := OpenDiskTier(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+	loads := make(map[string]int)
+	gee := NewGroup("disk", 256, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads[key]++
+			return []byte(strings.Repeat(key, 4)), nil
+		}), WithDiskTier(disk), WithShards(1), WithHotCache(-1))
+
+	keys := make([]string, 20)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%02d", i)
+		if _, err := gee.Get(keys[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := disk.Stats(); s.Items == 0 {
+		t.Fatalf("evicted entries should be written to disk")
+	}
+	for _, key := range keys {
+		if v, err := gee.Get(key); err != nil || v.String() != strings.Repeat(key, 4) {
+			t.Fatalf("Get(%s) = %q, %v", key, v, err)
+		}
+		if loads[key] != 1 {
+			t.Fatalf("%s loaded %d times, want it promoted from disk", key, loads[key])
+		}
+	}
+	if s := gee.Stats(); s.DiskHits == 0 || s.Hits < s.DiskHits {
+		t.Fatalf("disk hits not counted: %+v", s)
+	}
+
+	// 找到一个在磁盘上的 key
+	var onDisk string
+	for _, key := range keys {
+		if _, ok := gee.mainCache.get(key); !ok {
+			onDisk = key
+			break
+		}
+	}
+	// 管理接口可以查看磁盘上的缓存项，查看后仍在磁盘上
+	before := disk.Stats()
+	if info, ok := gee.peek(onDisk); !ok || info.Cache != "disk" || string(info.Value) != strings.Repeat(onDisk, 4) {
+		t.Fatalf("peek(%s) = %+v, %v", onDisk, info, ok)
+	}
+	if after := disk.Stats(); after != before {
+		t.Fatalf("peek changed the disk tier: %+v -> %+v", before, after)
+	}
+	if err := gee.Set(onDisk, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := gee.Get(onDisk); err != nil || v.String() != "new" {
+		t.Fatalf("Get(%s) after Set = %q, %v", onDisk, v, err)
+	}
+	if err := gee.Remove(onDisk); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gee.Get(onDisk); err != nil || loads[onDisk] != 2 {
+		t.Fatalf("Get(%s) after Remove should load again, loaded %d times", onDisk, loads[onDisk])
+	}
+
+	gee.Clear()
+	if s := disk.Stats(); s.Items != 0 || disk.FileSize() != 0 {
+		t.Fatalf("Clear left %d items, %d bytes on disk", s.Items, disk.FileSize())
+	}
+}
+
+// 测试淘汰的缓存项在释放分片锁之后才写入磁盘
+// 测试步骤
+//  1. spill 中访问同一个分片，分片锁未释放时会死锁
+//  2. 等待写入期间 key 被删除或重新写入时 claim 返回 false，旧值不会写入磁盘
+func TestCacheSpill(t *testing.T) {
+	c := &cache{cacheBytes: 10}
+	var claims []func() bool
+	c.spill = func(key string, value ByteView, claim func() bool) {
+		c.get(key)
+		claims = append(claims, claim)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, key := range []string{"k1", "k2", "k3", "k4", "k5", "k6"} {
+			c.add(key, ByteView{b: []byte("v")})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("spill called while holding the shard lock")
+	}
+	if len(claims) != 3 {
+		t.Fatalf("expect 3 spilled entries, got %d", len(claims))
+	}
+	c.remove("k1")
+	c.add("k2", ByteView{b: []byte("new")})
+	if claims[0]() || claims[1]() {
+		t.Fatalf("removed or rewritten keys should not be claimed")
+	}
+	if !claims[2]() || claims[2]() {
+		t.Fatalf("k3 should be claimed exactly once")
+	}
+}
+
+// 测试磁盘缓存的容量、过期时间和文件整理
+// 测试步骤
+//  1. 写入超过 maxBytes 的数据，最早的记录被淘汰
+//  2. 取出记录后文件中留下垃圾数据，Compact 之后文件变小，剩余记录仍可读取
+//  3. 过期时间随记录保存，已过期的记录读不到
+//  4. 记录被改写后校验失败，不会返回错误的数据
+func TestDiskTierCompact(t *testing.T) {
+	const valueLen = 100
+	recLen := int64(diskHeaderSize + len("k00") + valueLen)
+	disk, err := OpenDiskTier(t.TempDir(), 10*recLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+	disk.compactMin = 1 << 30
+
+	value := func(i int) ByteView {
+		return ByteView{b: []byte(strings.Repeat(fmt.Sprint(i%10), valueLen))}
+	}
+	for i := 0; i < 20; i++ {
+		disk.put(fmt.Sprintf("k%02d", i), value(i), nil)
+	}
+	s := disk.Stats()
+	if s.Items != 10 || s.Bytes > 10*recLen || s.Evictions != 10 {
+		t.Fatalf("stats = %+v, want 10 items within %d bytes", s, 10*recLen)
+	}
+	if _, ok := disk.take("k00"); ok {
+		t.Fatalf("k00 should have been evicted")
+	}
+
+	for i := 10; i < 15; i++ {
+		if v, ok := disk.take(fmt.Sprintf("k%02d", i)); !ok || v.String() != value(i).String() {
+			t.Fatalf("take(k%02d) = %q, %v", i, v, ok)
+		}
+	}
+	if err := disk.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if size := disk.FileSize(); size != 5*recLen {
+		t.Fatalf("file size after compaction = %d, want %d", size, 5*recLen)
+	}
+	if fi, err := os.Stat(disk.Path()); err != nil || fi.Size() != 5*recLen {
+		t.Fatalf("data file after compaction: %v, %v", fi, err)
+	}
+	if v, ok := disk.take("k15"); !ok || v.String() != value(15).String() {
+		t.Fatalf("take(k15) after compaction = %q, %v", v, ok)
+	}
+
+	expire := time.Now().Add(time.Hour).Round(0)
+	disk.put("ttl", ByteView{b: []byte("v"), e: expire}, nil)
+	if v, ok := disk.take("ttl"); !ok || !v.Expire().Equal(expire) {
+		t.Fatalf("take(ttl) = %v, %v, want expire %v", v.Expire(), ok, expire)
+	}
+	disk.put("expired", ByteView{b: []byte("v"), e: time.Now().Add(-time.Second)}, nil)
+	if _, ok := disk.take("expired"); ok {
+		t.Fatalf("expired record should not be returned")
+	}
+
+	disk.put("bad", ByteView{b: []byte("value")}, nil)
+	off := disk.FileSize() - 1
+	if _, err := disk.file.WriteAt([]byte("X"), off); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := disk.take("bad"); ok {
+		t.Fatalf("corrupted record should be rejected")
+	}
+
+	path := disk.Path()
+	if err := disk.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Close should remove the data file: %v", err)
+	}
+	if err := disk.Compact(); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("Compact after Close = %v", err)
+	}
+}
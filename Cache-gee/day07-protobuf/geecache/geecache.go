@@ -1,11 +1,17 @@
 package geecache
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	pb "geecache/geecachepb"
 	"geecache/singleflight"
+	"io"
 	"log"
+	"math/rand"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 /*
@@ -27,13 +33,152 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// TTLGetter 在 Getter 的基础上，允许回调函数为每个 key 返回各自的有效期。
+// 返回的 ttl 为 0 时使用缓存组的默认有效期。
+// 同时实现 ContextGetter 时优先调用 GetContext，需要 context 和有效期时实现 ContextTTLGetter
+type TTLGetter interface {
+	Getter
+	GetWithTTL(key string) ([]byte, time.Duration, error)
+}
+
+// TTLGetterFunc 接口型函数，实现 TTLGetter 接口
+type TTLGetterFunc func(key string) ([]byte, time.Duration, error)
+
+func (f TTLGetterFunc) Get(key string) ([]byte, error) {
+	b, _, err := f(key)
+	return b, err
+}
+
+func (f TTLGetterFunc) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	return f(key)
+}
+
+// ContextGetter 在 Getter 的基础上支持 context，
+// 调用方取消或超时后回调函数可以提前结束
+type ContextGetter interface {
+	Getter
+	GetContext(ctx context.Context, key string) ([]byte, error)
+}
+
+// ContextGetterFunc 接口型函数，实现 ContextGetter 接口
+type ContextGetterFunc func(ctx context.Context, key string) ([]byte, error)
+
+func (f ContextGetterFunc) Get(key string) ([]byte, error) {
+	return f(context.Background(), key)
+}
+
+func (f ContextGetterFunc) GetContext(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+// ContextTTLGetter 同时支持 context 和为每个 key 返回各自的有效期，优先于 TTLGetter 和 ContextGetter
+type ContextTTLGetter interface {
+	Getter
+	GetWithTTLContext(ctx context.Context, key string) ([]byte, time.Duration, error)
+}
+
+// ContextTTLGetterFunc 接口型函数，实现 ContextTTLGetter、TTLGetter 和 ContextGetter 接口
+type ContextTTLGetterFunc func(ctx context.Context, key string) ([]byte, time.Duration, error)
+
+func (f ContextTTLGetterFunc) Get(key string) ([]byte, error) {
+	b, _, err := f(context.Background(), key)
+	return b, err
+}
+
+func (f ContextTTLGetterFunc) GetContext(ctx context.Context, key string) ([]byte, error) {
+	b, _, err := f(ctx, key)
+	return b, err
+}
+
+func (f ContextTTLGetterFunc) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	return f(context.Background(), key)
+}
+
+func (f ContextTTLGetterFunc) GetWithTTLContext(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	return f(ctx, key)
+}
+
+// ReaderGetter 在 Getter 的基础上，允许回调函数以 io.ReadCloser 返回缓存值，适合文件、
+// HTTP 响应等较大的数据。size 为数据长度，未知时为 -1。数据直接读入缓存，不会再复制，
+// 超过 WithMaxValueBytes 的部分不会被读取
+type ReaderGetter interface {
+	Getter
+	GetReader(ctx context.Context, key string) (r io.ReadCloser, size int64, err error)
+}
+
+// ReaderGetterFunc 接口型函数，实现 ReaderGetter 接口
+type ReaderGetterFunc func(ctx context.Context, key string) (io.ReadCloser, int64, error)
+
+func (f ReaderGetterFunc) Get(key string) ([]byte, error) {
+	r, size, err := f(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	view, err := ReadByteView(r, size, 0)
+	return view.b, err
+}
+
+func (f ReaderGetterFunc) GetReader(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	return f(ctx, key)
+}
+
+// ErrNotFound 数据源中不存在 key。回调函数返回包装了 ErrNotFound 的错误时，
+// 缓存组会在 WithNegativeTTL 设置的时间内缓存这一结果，其余错误不会被缓存
+var ErrNotFound = errors.New("geecache: not found")
+
+// 返回包装了 ErrNotFound 的错误
+func notFound(key string) error {
+	return fmt.Errorf("%s: %w", key, ErrNotFound)
+}
+
+const (
+	// hotCache 默认占 mainCache 容量的 1/8
+	defaultHotCacheRatio = 8
+	// 从远程节点获取的数据有 1/10 的概率放入 hotCache
+	hotCachePopulateChance = 10
+	// 不存在的 key 默认最多占 mainCache 容量的 1/8
+	defaultNegativeCacheRatio = 8
+)
+
 type Group struct {
 	name      string
-	mainCache cache
-	getter    Getter
+	mainCache *shardedCache
+	// 保存从远程节点获取的热点数据副本，减少对负责节点的重复请求
+	hotCache *shardedCache
+	// 保存数据源中不存在的 key，未设置 negativeTTL 时为 nil
+	negCache *shardedCache
+	// 保存从 mainCache 淘汰的缓存项，未设置 WithDiskTier 时为 nil
+	disk   *DiskTier
+	getter Getter
 	//
 	peers  PeerPicker
 	loader *singleflight.Group
+	// 统计信息
+	stats groupStats
+	// 本地缓存的最大字节数
+	cacheBytes int64
+	// hotCache 的最大字节数，小于 0 表示不使用 hotCache
+	hotCacheBytes int64
+	// 本地缓存的淘汰策略
+	policy PolicyFunc
+	// 本地缓存的分片数
+	shards int
+	// 缓存值的默认有效期，0 表示永不过期
+	ttl time.Duration
+	// 缓存值的软有效期，0 表示不在后台刷新
+	softTTL time.Duration
+	// 正在后台刷新的 key
+	refreshing sync.Map
+	// 不存在的 key 的缓存时间，0 表示不缓存
+	negativeTTL time.Duration
+	// 缓存值的最大长度，0 表示不限制
+	maxValueBytes int64
+	// 后台清理过期缓存的间隔，0 表示不启动清理协程
+	janitorInterval time.Duration
+	// 关闭后台清理协程
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
 var (
@@ -49,22 +194,80 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 }
 
 // 创建缓存组也要支持并发
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
 	mu.Lock()
 	defer mu.Unlock()
 	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
-		loader:    &singleflight.Group{},
+		name:          name,
+		getter:        getter,
+		cacheBytes:    cacheBytes,
+		hotCacheBytes: fractionBytes(cacheBytes, defaultHotCacheRatio),
+		loader:        &singleflight.Group{},
+		shards:        1,
+		stop:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.mainCache = newShardedCache(g.shards, g.cacheBytes, g.policy)
+	if g.disk != nil {
+		g.mainCache.setSpill(g.disk.put)
+	}
+	if g.hotCacheBytes >= 0 {
+		g.hotCache = newShardedCache(g.shards, g.hotCacheBytes, g.policy)
+	}
+	if g.negativeTTL > 0 {
+		g.negCache = newShardedCache(g.shards, fractionBytes(g.cacheBytes, defaultNegativeCacheRatio), nil)
+	}
+	// 设置了默认有效期但未指定清理间隔时，以有效期作为清理间隔
+	if g.janitorInterval == 0 {
+		g.janitorInterval = g.ttl
+	}
+	if g.janitorInterval == 0 {
+		g.janitorInterval = g.negativeTTL
+	}
+	if g.janitorInterval > 0 {
+		go g.janitor()
+	}
+	// 同名的缓存组被替换后不再使用，停止它的清理协程
+	if old, ok := groups[name]; ok {
+		old.Close()
 	}
 	groups[name] = g
 	return g
 }
 
+// Close 停止缓存组的后台清理协程
+func (g *Group) Close() {
+	g.stopOnce.Do(func() { close(g.stop) })
+}
+
+// 后台定期清理已过期的缓存项，未被访问的过期数据也能及时释放内存
+func (g *Group) janitor() {
+	ticker := time.NewTicker(g.janitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			g.mainCache.removeExpired()
+			if g.hotCache != nil {
+				g.hotCache.removeExpired()
+			}
+			if g.negCache != nil {
+				g.negCache.removeExpired()
+			}
+			if g.disk != nil {
+				g.disk.removeExpired()
+			}
+		case <-g.stop:
+			return
+		}
+	}
+}
+
 // 获取缓存组也要支持并发 使用读锁
 // 允许多个线程同时调用 GetGroup
 func GetGroup(name string) *Group {
@@ -80,58 +283,381 @@ func GetGroup(name string) *Group {
 }
 
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 获取缓存值，ctx 被取消或超时后立即返回 ctx.Err()。
+// 同一个 key 的并发加载会被合并，某个调用方取消不会影响其他调用方，
+// ctx 的截止时间会随请求转发给远程节点。key 不存在时返回包装了 ErrNotFound 的错误
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
-	if v, ok := g.mainCache.get(key); ok {
-		log.Println("[GeeCache] hit")
+	g.stats.gets.Add(1)
+	if v, ok := g.lookupCache(key); ok {
+		g.stats.hits.Add(1)
 		return v, nil
 	}
-	return g.load(key)
+	if g.lookupNotFound(key) {
+		g.stats.negativeHits.Add(1)
+		return ByteView{}, notFound(key)
+	}
+	g.stats.misses.Add(1)
+	return g.load(ctx, key)
 }
 
-func (g *Group) load(key string) (value ByteView, err error) {
+// 标记只在本节点加载的请求
+type localOnlyKey struct{}
+
+// 返回只在本节点加载、不再选择远程节点的 ctx。
+// 远程节点转发来的请求已经由请求方选择过节点，再次选择会把 key 送回负责的节点，
+// 或在启用有界负载时在节点之间来回转发
+func withLocalOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, localOnlyKey{}, true)
+}
 
-	viewi, err := g.loader.Do(key, func() (interface{}, error) {
+func localOnly(ctx context.Context) bool {
+	v, _ := ctx.Value(localOnlyKey{}).(bool)
+	return v
+}
 
-		if g.peers != nil {
+func (g *Group) load(ctx context.Context, key string) (value ByteView, err error) {
+	// 只有实际执行加载的请求会把 executed 置为 true，其余请求合并到同一次加载中。
+	// 加载在单独的 goroutine 中执行，调用方放弃等待后仍可能写入，所以使用原子变量
+	var executed atomic.Bool
+	viewi, err, _ := g.loader.DoContext(ctx, key, func(ctx context.Context) (interface{}, error) {
+		executed.Store(true)
+		if g.peers != nil && !localOnly(ctx) {
 			if peer, ok := g.peers.PickPeer(key); ok {
-				if value, err = g.getFromPeer(peer, key); err == nil {
+				value, err := g.getFromPeer(ctx, peer, key)
+				if err == nil {
+					g.peerLoaded(key, value)
 					return value, nil
 				}
+				// 负责该 key 的节点确认不存在，不再回退到本地加载
+				if errors.Is(err, ErrNotFound) {
+					g.stats.peerLoads.Add(1)
+					g.populateNotFound(key)
+					return nil, err
+				}
+				g.stats.peerErrors.Add(1)
 				log.Println("[GeeCache] Failed to get from peer", err)
+				// 已超时或被取消时不再回退到本地加载
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
 			}
 		}
-		return g.getLocally(key)
+		value, err := g.getLocally(ctx, key)
+		if err != nil {
+			g.stats.localLoadErrs.Add(1)
+			return nil, err
+		}
+		g.stats.localLoads.Add(1)
+		return value, nil
 	})
+	if !executed.Load() {
+		g.stats.dedups.Add(1)
+	}
 	if err == nil {
 		return viewi.(ByteView), err
 	}
 	return
 }
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.getter.Get(key)
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
+	var (
+		value ByteView
+		ttl   time.Duration
+		err   error
+	)
+	// 回调函数支持返回有效期时，优先使用其返回的有效期；
+	// 支持 context 时总是传入 ctx，调用方取消或超时后回调函数可以提前结束
+	switch getter := g.getter.(type) {
+	case ReaderGetter:
+		value, err = g.readValue(ctx, getter, key)
+	case ContextTTLGetter:
+		value.b, ttl, err = getter.GetWithTTLContext(ctx, key)
+	case ContextGetter:
+		value.b, err = getter.GetContext(ctx, key)
+	case TTLGetter:
+		value.b, ttl, err = getter.GetWithTTL(key)
+	default:
+		value.b, err = g.getter.Get(key)
+	}
+	if err == nil {
+		err = g.checkSize(key, value.b)
+	}
 	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			g.populateNotFound(key)
+		}
 		return ByteView{}, err
 	}
-	value := ByteView{b: cloneBytes(bytes)}
+	if _, ok := g.getter.(ReaderGetter); !ok {
+		value.b = cloneBytes(value.b)
+	}
+	value.e = g.expireAt(ttl)
 	g.populateCache(key, value)
 	return value, nil
 }
 
+// 从回调函数返回的 Reader 中读取缓存值，读到的数据不需要复制
+func (g *Group) readValue(ctx context.Context, getter ReaderGetter, key string) (ByteView, error) {
+	r, size, err := getter.GetReader(ctx, key)
+	if err != nil {
+		return ByteView{}, err
+	}
+	defer r.Close()
+	view, err := ReadByteView(r, size, g.maxValueBytes)
+	if err != nil {
+		return ByteView{}, fmt.Errorf("%s: %w", key, err)
+	}
+	return view, nil
+}
+
+// 检查缓存值是否超过 WithMaxValueBytes 设置的最大长度
+func (g *Group) checkSize(key string, value []byte) error {
+	if g.maxValueBytes > 0 && int64(len(value)) > g.maxValueBytes {
+		return fmt.Errorf("%s: %w: %d bytes", key, ErrValueTooLarge, len(value))
+	}
+	return nil
+}
+
+// 根据有效期计算过期时间，ttl 为 0 时使用默认有效期
+func (g *Group) expireAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		ttl = g.ttl
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
 func (g *Group) populateCache(key string, value ByteView) {
+	if g.softTTL > 0 {
+		value.s = time.Now().Add(g.softTTL)
+	}
+	if g.negCache != nil {
+		g.negCache.remove(key)
+	}
 	g.mainCache.add(key, value)
+	// 磁盘上的旧值已失效。先写入 mainCache，正在写入磁盘的旧值无法再通过 claim
+	if g.disk != nil {
+		g.disk.remove(key)
+	}
+}
+
+// 在后台重新加载已变旧的 key，同一个 key 同时只有一个刷新协程。
+// 加载与普通的 Get 共用 singleflight，失败时保留旧值
+func (g *Group) refresh(key string) {
+	if _, loaded := g.refreshing.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+	go func() {
+		defer g.refreshing.Delete(key)
+		value, err := g.load(context.Background(), key)
+		if err != nil {
+			log.Println("[GeeCache] Failed to refresh", key, err)
+			return
+		}
+		// 从远程节点加载的值不会写入 mainCache，替换其中仍未更新的旧值
+		if old, ok := g.mainCache.peek(key); ok && old.stale(time.Now()) {
+			g.populateCache(key, value)
+		}
+	}()
+}
+
+// 记录 key 不存在，negativeTTL 后过期
+func (g *Group) populateNotFound(key string) {
+	if g.negCache != nil {
+		g.negCache.add(key, ByteView{e: time.Now().Add(g.negativeTTL)})
+	}
+}
+
+// key 是否被记录为不存在
+func (g *Group) lookupNotFound(key string) bool {
+	if g.negCache == nil {
+		return false
+	}
+	_, ok := g.negCache.get(key)
+	return ok
 }
 
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
+// 从远程节点获取成功，按一定概率在本地保留一份副本，热点数据被多次访问后大概率会留在本地
+func (g *Group) peerLoaded(key string, value ByteView) {
+	g.stats.peerLoads.Add(1)
+	if g.hotCache != nil && rand.Intn(hotCachePopulateChance) == 0 {
+		g.hotCache.add(key, value)
+	}
+}
+
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
 	req := &pb.Request{
 		Group: g.name,
 		Key:   key,
 	}
 	res := &pb.Response{}
-	err := peer.Get(req, res)
+	err := peer.Get(ctx, req, res)
 	if err != nil {
 		return ByteView{}, err
 	}
-	return ByteView{b: res.Value}, nil
+	if res.Status == pb.Status_NOT_FOUND {
+		return ByteView{}, notFound(key)
+	}
+	if err := g.checkSize(key, res.Value); err != nil {
+		return ByteView{}, err
+	}
+	// 远程节点返回的过期时间一并带回
+	var expire time.Time
+	if res.Expire != 0 {
+		expire = time.Unix(0, res.Expire)
+	}
+	return ByteView{b: res.Value, e: expire}, nil
+}
+
+// Set 写入缓存值。值写入负责该 key 的节点，其余节点上的旧副本会被删除
+func (g *Group) Set(key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if err := g.checkSize(key, value); err != nil {
+		return err
+	}
+	view := ByteView{b: cloneBytes(value), e: g.expireAt(0)}
+	owner := g.pickOwner(key)
+	if owner != nil {
+		req := &pb.SetRequest{
+			Group: g.name,
+			Key:   key,
+			Value: view.b,
+		}
+		if !view.e.IsZero() {
+			req.Expire = view.e.UnixNano()
+		}
+		if err := owner.Set(context.Background(), req, &pb.Response{}); err != nil {
+			return err
+		}
+		g.removeLocally(key)
+	} else {
+		g.populateCache(key, view)
+	}
+	return g.invalidate(key, owner)
+}
+
+// Remove 删除缓存值。负责该 key 的节点和其余节点上的副本都会被删除
+func (g *Group) Remove(key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	owner := g.pickOwner(key)
+	if owner != nil {
+		if err := owner.Remove(context.Background(), &pb.Request{Group: g.name, Key: key}, &pb.Response{}); err != nil {
+			return err
+		}
+	}
+	g.removeLocally(key)
+	return g.invalidate(key, owner)
+}
+
+// 返回负责该 key 的远程节点，由本节点负责时返回 nil
+func (g *Group) pickOwner(key string) PeerGetter {
+	if g.peers == nil {
+		return nil
+	}
+	if op, ok := g.peers.(OwnerPicker); ok {
+		if peer, ok := op.PickOwner(key); ok {
+			return peer
+		}
+		return nil
+	}
+	if peer, ok := g.peers.PickPeer(key); ok {
+		return peer
+	}
+	return nil
+}
+
+// 并发通知除 owner 以外的所有远程节点删除 key 的副本
+func (g *Group) invalidate(key string, owner PeerGetter) error {
+	if g.peers == nil {
+		return nil
+	}
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, peer := range g.peers.GetAll() {
+		if peer == owner {
+			continue
+		}
+		wg.Add(1)
+		go func(peer PeerGetter) {
+			defer wg.Done()
+			if err := peer.Remove(context.Background(), &pb.Request{Group: g.name, Key: key}, &pb.Response{}); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}(peer)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// 远程节点写入的缓存值只保存在本地，不再转发
+func (g *Group) localSet(key string, value ByteView) {
+	g.populateCache(key, value)
+}
+
+// 远程节点要求删除的缓存值只从本地删除，不再转发
+func (g *Group) localRemove(key string) {
+	g.removeLocally(key)
+}
+
+// 从 mainCache 和 hotCache 中删除 key，同时清除不存在的记录
+func (g *Group) removeLocally(key string) {
+	g.mainCache.remove(key)
+	if g.hotCache != nil {
+		g.hotCache.remove(key)
+	}
+	if g.negCache != nil {
+		g.negCache.remove(key)
+	}
+	if g.disk != nil {
+		g.disk.remove(key)
+	}
+}
+
+// CacheType 本地缓存的类型
+type CacheType int
+
+const (
+	// MainCache 保存由本节点负责的数据
+	MainCache CacheType = iota + 1
+	// HotCache 保存从远程节点获取的热点数据副本
+	HotCache
+	// DiskCache 保存从 mainCache 淘汰的缓存项，见 WithDiskTier
+	DiskCache
+)
+
+// CacheStats 返回指定本地缓存的统计信息。
+// HotCache 的命中次数即被 hotCache 吸收、无需再请求远程节点的次数
+func (g *Group) CacheStats(which CacheType) CacheStats {
+	switch which {
+	case MainCache:
+		return g.mainCache.stats()
+	case HotCache:
+		if g.hotCache != nil {
+			return g.hotCache.stats()
+		}
+		return CacheStats{}
+	case DiskCache:
+		if g.disk != nil {
+			return g.disk.Stats()
+		}
+		return CacheStats{}
+	default:
+		return CacheStats{}
+	}
 }
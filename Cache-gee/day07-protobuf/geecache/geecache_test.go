@@ -1,10 +1,18 @@
 package geecache
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	pb "geecache/geecachepb"
+	"io"
 	"log"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 var db = map[string]string{
@@ -68,3 +76,670 @@ func TestGet(t *testing.T) {
 	}
 
 }
+
+// 测试缓存过期
+// 测试步骤
+//  1. 创建默认有效期为20ms的缓存组，回调函数返回的key1有效期为200ms
+//  2. 第一次获取后数据被缓存，再次获取不会调用回调函数
+//  3. 等待默认有效期过去后，Tom过期需要重新加载，key1仍然命中缓存
+func TestGetTTL(t *testing.T) {
+	loadCounts := make(map[string]int)
+	gee := NewGroup("ttl", 2<<10, TTLGetterFunc(
+		func(key string) ([]byte, time.Duration, error) {
+			loadCounts[key]++
+			if key == "key1" {
+				return []byte(key), 200 * time.Millisecond, nil
+			}
+			return []byte(key), 0, nil
+		}), WithTTL(20*time.Millisecond))
+	defer gee.Close()
+
+	for _, k := range []string{"Tom", "key1"} {
+		if _, err := gee.Get(k); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := gee.Get(k); err != nil || loadCounts[k] != 1 {
+			t.Fatalf("cache %s miss", k)
+		}
+	}
+	time.Sleep(40 * time.Millisecond)
+	if _, err := gee.Get("Tom"); err != nil || loadCounts["Tom"] != 2 {
+		t.Fatalf("expired Tom should be reloaded, load count %d", loadCounts["Tom"])
+	}
+	if _, err := gee.Get("key1"); err != nil || loadCounts["key1"] != 1 {
+		t.Fatalf("key1 with its own ttl should not be reloaded, load count %d", loadCounts["key1"])
+	}
+}
+
+// 测试后台清理协程回收过期缓存
+func TestJanitor(t *testing.T) {
+	gee := NewGroup("janitor", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithTTL(10*time.Millisecond), WithJanitor(5*time.Millisecond))
+	defer gee.Close()
+
+	for _, k := range []string{"Tom", "Jack", "Sam"} {
+		gee.Get(k)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := gee.mainCache.stats().Items; n != 0 {
+		t.Fatalf("janitor should remove all expired entries, %d left", n)
+	}
+
+	// 同名缓存组替换旧的缓存组时，旧的清理协程被停止
+	replaced := NewGroup("janitor", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithTTL(10*time.Millisecond), WithJanitor(5*time.Millisecond))
+	defer replaced.Close()
+	select {
+	case <-gee.stop:
+	default:
+		t.Fatal("replaced group should be closed")
+	}
+}
+
+// 测试用的远程节点，记录被请求的次数
+type fakePeer struct {
+	gets    int
+	batches int
+	// 不为空时所有请求都返回该错误
+	err error
+}
+
+func (p *fakePeer) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	p.gets++
+	if p.err != nil {
+		return p.err
+	}
+	if in.Key == "missing" {
+		out.Status = pb.Status_NOT_FOUND
+		return nil
+	}
+	out.Value = []byte(in.Key + "@peer")
+	return nil
+}
+
+// GetMulti 批量获取，key 为 bad 时返回错误，key 为 missing 时返回不存在
+func (p *fakePeer) GetMulti(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	p.batches++
+	if p.err != nil {
+		return p.err
+	}
+	for _, key := range in.Keys {
+		e := &pb.BatchEntry{Key: key, Value: []byte(key + "@peer")}
+		switch key {
+		case "bad":
+			e = &pb.BatchEntry{Key: key, Error: "boom"}
+		case "missing":
+			e = &pb.BatchEntry{Key: key, Error: "missing: not found", Status: pb.Status_NOT_FOUND}
+		}
+		out.Entries = append(out.Entries, e)
+	}
+	return nil
+}
+
+func (p *fakePeer) Set(ctx context.Context, in *pb.SetRequest, out *pb.Response) error { return nil }
+
+func (p *fakePeer) Remove(ctx context.Context, in *pb.Request, out *pb.Response) error { return nil }
+
+// 测试用的节点选择器，所有 key 都由 peer 负责
+type fakePicker struct {
+	peer *fakePeer
+}
+
+func (p *fakePicker) PickPeer(key string) (PeerGetter, bool) { return p.peer, true }
+
+func (p *fakePicker) GetAll() []PeerGetter { return []PeerGetter{p.peer} }
+
+// 测试 hotCache 吸收对远程节点的重复请求
+// 测试步骤
+//  1. 所有 key 都由远程节点负责，连续获取同一个 key 1000 次
+//  2. 数据被放入 hotCache 后不再请求远程节点，远程节点的请求次数远小于 1000
+//  3. hotCache 的命中次数加上远程请求次数等于总次数
+//  4. Remove 之后 hotCache 中的副本被删除
+func TestHotCache(t *testing.T) {
+	peer := &fakePeer{}
+	gee := NewGroup("hot", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key + "@local"), nil
+		}))
+	gee.RegisterPeers(&fakePicker{peer: peer})
+
+	for i := 0; i < 1000; i++ {
+		if v, err := gee.Get("Tom"); err != nil || v.String() != "Tom@peer" {
+			t.Fatalf("Get(Tom) = %q, %v", v, err)
+		}
+	}
+	hot := gee.CacheStats(HotCache)
+	if peer.gets >= 100 || hot.Hits+int64(peer.gets) != 1000 || hot.Items != 1 {
+		t.Fatalf("hot cache absorbed %d, peer served %d", hot.Hits, peer.gets)
+	}
+	if main := gee.CacheStats(MainCache); main.Items != 0 {
+		t.Fatalf("values from peers should not be stored in main cache")
+	}
+
+	if err := gee.Remove("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if hot := gee.CacheStats(HotCache); hot.Items != 0 {
+		t.Fatalf("Remove should drop the hot copy")
+	}
+}
+
+// 测试统计信息
+// 测试步骤
+//  1. 10 个 goroutine 同时获取同一个慢 key，只有一个实际调用回调函数，其余计为合并
+//  2. 再次获取命中缓存，获取不存在的 key 计为加载失败
+//  3. 远程节点返回错误时计为远程失败，并回退到本地加载
+func TestStats(t *testing.T) {
+	release := make(chan struct{})
+	gee := NewGroup("stats", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "slow" {
+				<-release
+			}
+			if v, ok := db[key]; ok || key == "slow" {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gee.Get("slow")
+		}()
+	}
+	for gee.Stats().Misses < n {
+		time.Sleep(time.Millisecond)
+	}
+	// 等待所有请求进入 singleflight
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	gee.Get("slow")
+	gee.Get("unknown")
+	s := gee.Stats()
+	if s.Gets != n+2 || s.Hits != 1 || s.Misses != n+1 {
+		t.Fatalf("gets/hits/misses = %d/%d/%d", s.Gets, s.Hits, s.Misses)
+	}
+	if s.LocalLoads != 1 || s.Dedups != n-1 || s.LocalLoadErrs != 1 {
+		t.Fatalf("loads/dedups/errs = %d/%d/%d", s.LocalLoads, s.Dedups, s.LocalLoadErrs)
+	}
+	if s.Items != 1 || s.Bytes != int64(len("slow")) {
+		t.Fatalf("items/bytes = %d/%d", s.Items, s.Bytes)
+	}
+
+	gee.RegisterPeers(&fakePicker{peer: &fakePeer{err: fmt.Errorf("down")}})
+	if v, err := gee.Get("Tom"); err != nil || v.String() != db["Tom"] {
+		t.Fatalf("Get(Tom) = %q, %v", v, err)
+	}
+	if s := gee.Stats(); s.PeerErrors != 1 || s.PeerLoads != 0 || s.LocalLoads != 2 {
+		t.Fatalf("peer errors/peer loads/local loads = %d/%d/%d", s.PeerErrors, s.PeerLoads, s.LocalLoads)
+	}
+}
+
+// 测试 GetContext 的超时
+// 测试步骤
+//  1. 回调函数一直阻塞到 ctx 结束，GetContext 在超时后返回 context.DeadlineExceeded
+//  2. 唯一的调用方放弃等待后，回调函数的 ctx 也被取消
+func TestGetContext(t *testing.T) {
+	cancelled := make(chan struct{})
+	gee := NewGroup("context", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			<-ctx.Done()
+			close(cancelled)
+			return nil, ctx.Err()
+		}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := gee.GetContext(ctx, "Tom"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetContext = %v, want context.DeadlineExceeded", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("getter should be cancelled")
+	}
+}
+
+// 同时实现 TTLGetter 和 ContextGetter 的回调函数
+type ttlContextGetter struct {
+	ContextGetterFunc
+}
+
+func (ttlContextGetter) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	return []byte(key), time.Hour, nil
+}
+
+// 测试带有效期的回调函数也能收到 ctx
+// 测试步骤
+//  1. ContextTTLGetter 收到调用方的 ctx，返回的有效期生效
+//  2. 同时实现 TTLGetter 和 ContextGetter 时调用 GetContext，ctx 被取消后回调函数提前结束
+func TestContextTTLGetter(t *testing.T) {
+	type ctxKey struct{}
+	gee := NewGroup("context-ttl", 2<<10, ContextTTLGetterFunc(
+		func(ctx context.Context, key string) ([]byte, time.Duration, error) {
+			return []byte(fmt.Sprint(ctx.Value(ctxKey{}))), time.Hour, nil
+		}))
+	ctx := context.WithValue(context.Background(), ctxKey{}, "from-ctx")
+	v, err := gee.GetContext(ctx, "Tom")
+	if err != nil || v.String() != "from-ctx" {
+		t.Fatalf("GetContext = %q, %v", v, err)
+	}
+	if d := time.Until(v.Expire()); d < 59*time.Minute || d > time.Hour {
+		t.Fatalf("ttl from getter not applied, expires in %v", d)
+	}
+
+	both := NewGroup("context-and-ttl", 2<<10, ttlContextGetter{ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := both.GetContext(ctx, "Tom"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GetContext = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// 测试批量获取
+// 测试步骤
+//  1. Sam 已在缓存中，直接命中；重复的 key 只加载一次
+//  2. 其余 key 由本节点负责，回调函数只被调用一次，不存在的 key 返回错误
+//  3. 注册远程节点后，未命中的 key 合并为一次批量请求，远程节点返回的错误不回退到本地
+func TestGetMulti(t *testing.T) {
+	var batches [][]string
+	gee := NewGroup("multi", 2<<10, BatchGetterFunc(
+		func(ctx context.Context, keys []string) (map[string][]byte, error) {
+			batches = append(batches, keys)
+			values := make(map[string][]byte)
+			for _, key := range keys {
+				if v, ok := db[key]; ok {
+					values[key] = []byte(v)
+				}
+			}
+			return values, nil
+		}))
+	gee.Get("Sam")
+	batches = nil
+
+	values, err := gee.GetMulti(context.Background(), []string{"Tom", "Sam", "Jack", "unknown", "Tom"})
+	if err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Fatalf("expect error for unknown key, got %v", err)
+	}
+	if len(values) != 3 || values["Tom"].String() != db["Tom"] || values["Sam"].String() != db["Sam"] || values["Jack"].String() != db["Jack"] {
+		t.Fatalf("GetMulti = %v", values)
+	}
+	if !reflect.DeepEqual(batches, [][]string{{"Tom", "Jack", "unknown"}}) {
+		t.Fatalf("getter batches = %v", batches)
+	}
+	// 加上预先加载的 Sam 共 3 次成功加载
+	if s := gee.Stats(); s.Hits != 1 || s.LocalLoads != 3 || s.LocalLoadErrs != 1 {
+		t.Fatalf("hits/loads/errs = %d/%d/%d", s.Hits, s.LocalLoads, s.LocalLoadErrs)
+	}
+
+	peer := &fakePeer{}
+	gee.RegisterPeers(&fakePicker{peer: peer})
+	values, err = gee.GetMulti(context.Background(), []string{"a", "b", "bad", "Tom"})
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("expect error from peer, got %v", err)
+	}
+	if peer.batches != 1 || peer.gets != 0 {
+		t.Fatalf("expect one batch request, got %d batches and %d gets", peer.batches, peer.gets)
+	}
+	if len(values) != 3 || values["a"].String() != "a@peer" || values["Tom"].String() != db["Tom"] {
+		t.Fatalf("GetMulti = %v", values)
+	}
+
+	// 不支持批量请求的节点确认 key 不存在时，不回退到本地加载，并记入 negCache
+	var localLoads int
+	single := NewGroup("multi-single", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			localLoads++
+			return []byte(key + "@local"), nil
+		}), WithNegativeTTL(time.Minute))
+	peer = &fakePeer{}
+	single.RegisterPeers(&singlePicker{peer: peer})
+	values, err = single.GetMulti(context.Background(), []string{"a", "missing"})
+	if !errors.Is(err, ErrNotFound) || len(values) != 1 || localLoads != 0 {
+		t.Fatalf("GetMulti = %v, %v, %d local loads", values, err, localLoads)
+	}
+	if _, err := single.Get("missing"); !errors.Is(err, ErrNotFound) || peer.gets != 2 {
+		t.Fatalf("missing key should be served from negCache, peer got %d requests", peer.gets)
+	}
+
+	// 远程节点请求失败的 key 在本地加载，不再请求同一个节点
+	fallback := NewGroup("multi-fallback", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key + "@local"), nil
+		}))
+	peer = &fakePeer{err: errors.New("down")}
+	fallback.RegisterPeers(&singlePicker{peer: peer})
+	values, err = fallback.GetMulti(context.Background(), []string{"a", "b"})
+	if err != nil || values["a"].String() != "a@local" || values["b"].String() != "b@local" {
+		t.Fatalf("GetMulti = %v, %v", values, err)
+	}
+	if s := fallback.Stats(); peer.gets != 2 || s.PeerErrors != 2 || s.LocalLoads != 2 {
+		t.Fatalf("peer gets/errors/local loads = %d/%d/%d", peer.gets, s.PeerErrors, s.LocalLoads)
+	}
+
+	// 超过 maxBatchKeys 的 key 分成多次批量请求，远程节点拒绝过多的 key
+	peer = &fakePeer{}
+	many := NewGroup("multi-many", 0, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	many.RegisterPeers(&fakePicker{peer: peer})
+	keys := make([]string, maxBatchKeys+2)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+	}
+	if values, err := many.GetMulti(context.Background(), keys); err != nil || len(values) != len(keys) || peer.batches != 2 {
+		t.Fatalf("GetMulti got %d values in %d batches, %v", len(values), peer.batches, err)
+	}
+	if _, err := many.batchResponse(context.Background(), keys); err == nil {
+		t.Fatal("expect error for too many keys in one batch")
+	}
+}
+
+// 测试用的节点选择器，返回的节点不支持批量请求
+type singlePicker struct {
+	peer *fakePeer
+}
+
+func (p *singlePicker) PickPeer(key string) (PeerGetter, bool) {
+	return struct{ PeerGetter }{p.peer}, true
+}
+
+func (p *singlePicker) GetAll() []PeerGetter { return []PeerGetter{p.peer} }
+
+// 测试快照的保存与恢复
+// 测试步骤
+//  1. 写入3个缓存项，其中一个带过期时间，保存快照
+//  2. 新的缓存组加载快照，缓存项、过期时间和淘汰顺序都与原来一致，且不调用 getter
+//  3. 修改快照中的任意一个字节后加载失败，返回 ErrBadSnapshot，且不写入任何缓存项
+func TestSnapshot(t *testing.T) {
+	src := NewGroup("snapshot-src", 0, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	expire := time.Now().Add(time.Hour)
+	src.mainCache.add("Tom", ByteView{b: []byte("630")})
+	src.mainCache.add("Jack", ByteView{b: []byte("589"), e: expire})
+	src.mainCache.add("Sam", ByteView{b: []byte("567")})
+	src.mainCache.get("Tom")
+	var buf bytes.Buffer
+	if err := src.SaveSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loads := 0
+	dst := NewGroup("snapshot-dst", 0, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	if n, err := dst.LoadSnapshot(bytes.NewReader(buf.Bytes())); err != nil || n != 3 {
+		t.Fatalf("LoadSnapshot = %d, %v", n, err)
+	}
+	var keys []string
+	for _, e := range dst.mainCache.entries() {
+		keys = append(keys, e.key)
+	}
+	if !reflect.DeepEqual(keys, []string{"Jack", "Sam", "Tom"}) {
+		t.Fatalf("expect order %v, got %v", []string{"Jack", "Sam", "Tom"}, keys)
+	}
+	if view, err := dst.Get("Jack"); err != nil || view.String() != "589" || !view.Expire().Equal(time.Unix(0, expire.UnixNano())) {
+		t.Fatalf("restore Jack failed: %v %v", view, err)
+	}
+	if loads != 0 {
+		t.Fatalf("restored keys should not be loaded, got %d loads", loads)
+	}
+
+	corrupt := NewGroup("snapshot-corrupt", 0, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	for i := range buf.Len() {
+		data := bytes.Clone(buf.Bytes())
+		data[i] ^= 0xff
+		if _, err := corrupt.LoadSnapshot(bytes.NewReader(data)); !errors.Is(err, ErrBadSnapshot) {
+			t.Fatalf("corrupt byte %d: expect ErrBadSnapshot, got %v", i, err)
+		}
+	}
+	if _, err := corrupt.LoadSnapshot(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); !errors.Is(err, ErrBadSnapshot) {
+		t.Fatalf("truncated snapshot: expect ErrBadSnapshot, got %v", err)
+	}
+	if n := corrupt.Stats().Items; n != 0 {
+		t.Fatalf("corrupt snapshot should not be loaded, got %d items", n)
+	}
+}
+
+// 测试缓存不存在的 key
+// 测试步骤
+//  1. 回调函数返回 ErrNotFound 后结果被缓存，negativeTTL 内不再调用回调函数
+//  2. 其他错误不被缓存，每次都调用回调函数
+//  3. Set 之后不存在的记录被清除，negativeTTL 过后重新加载
+//  4. 远程节点返回 NOT_FOUND 时不回退到本地加载，结果同样被缓存
+func TestNegativeCache(t *testing.T) {
+	loads := make(map[string]int)
+	gee := NewGroup("negative", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads[key]++
+			if key == "flaky" {
+				return nil, fmt.Errorf("connection reset")
+			}
+			return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+		}), WithNegativeTTL(50*time.Millisecond))
+	defer gee.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := gee.Get("Tom"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expect ErrNotFound, got %v", err)
+		}
+		if _, err := gee.Get("flaky"); err == nil || errors.Is(err, ErrNotFound) {
+			t.Fatalf("expect transient error, got %v", err)
+		}
+	}
+	if loads["Tom"] != 1 || loads["flaky"] != 3 {
+		t.Fatalf("loads = %v, want Tom once and flaky 3 times", loads)
+	}
+	if s := gee.Stats(); s.NegativeHits != 2 {
+		t.Fatalf("expect 2 negative hits, got %d", s.NegativeHits)
+	}
+	if _, err := gee.GetMulti(context.Background(), []string{"Tom"}); !errors.Is(err, ErrNotFound) || loads["Tom"] != 1 {
+		t.Fatalf("GetMulti should hit the not-found cache, got %v", err)
+	}
+
+	if err := gee.Set("Tom", []byte("630")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("Set should clear the not-found entry, got %q, %v", v, err)
+	}
+	gee.Get("Jack")
+	time.Sleep(60 * time.Millisecond)
+	gee.Get("Jack")
+	if loads["Jack"] != 2 {
+		t.Fatalf("not-found entry should expire, loaded Jack %d times", loads["Jack"])
+	}
+
+	peer := &fakePeer{}
+	remote := NewGroup("negative-peer", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			t.Fatalf("should not load %s locally", key)
+			return nil, nil
+		}), WithNegativeTTL(time.Minute))
+	remote.RegisterPeers(&fakePicker{peer: peer})
+	for i := 0; i < 3; i++ {
+		if _, err := remote.Get("missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expect ErrNotFound from peer, got %v", err)
+		}
+	}
+	if peer.gets != 1 {
+		t.Fatalf("peer should be asked once, got %d", peer.gets)
+	}
+	remote.Remove("missing")
+	if _, err := remote.GetMulti(context.Background(), []string{"missing", "Sam"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound from batch, got %v", err)
+	}
+	if _, err := remote.Get("missing"); !errors.Is(err, ErrNotFound) || peer.gets != 1 {
+		t.Fatalf("batch result should be cached, peer gets %d, err %v", peer.gets, err)
+	}
+}
+
+// 测试软过期后在后台刷新
+// 测试步骤
+//  1. 超过软有效期后 Get 立即返回旧值，并且只触发一次后台加载
+//  2. 后台加载完成后返回新值
+//  3. 加载失败时继续返回旧值，超过硬有效期后不再返回
+//  4. key 由远程节点负责时，刷新得到的新值替换 mainCache 中的旧值
+func TestStaleWhileRevalidate(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		version int
+		fail    bool
+	)
+	// 第一次之后的加载都要等待 release
+	release := make(chan struct{}, 1)
+	gee := NewGroup("stale", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			mu.Lock()
+			first := version == 0
+			mu.Unlock()
+			if !first {
+				<-release
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if fail {
+				return nil, fmt.Errorf("db down")
+			}
+			version++
+			return []byte(fmt.Sprintf("v%d", version)), nil
+		}), WithSoftTTL(20*time.Millisecond), WithTTL(200*time.Millisecond), WithJanitor(time.Hour))
+	defer gee.Close()
+
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "v1" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		if v, err := gee.Get("Tom"); err != nil || v.String() != "v1" {
+			t.Fatalf("stale Get = %q, %v, want v1", v, err)
+		}
+	}
+	if s := gee.Stats(); s.StaleHits != 10 || s.Dedups != 0 {
+		t.Fatalf("stale hits/dedups = %d/%d", s.StaleHits, s.Dedups)
+	}
+	release <- struct{}{}
+	waitFor(t, "refreshed value", func() bool {
+		v, _ := gee.Get("Tom")
+		return v.String() == "v2"
+	})
+	if s := gee.Stats(); s.LocalLoads != 2 {
+		t.Fatalf("expect a single background reload, got %d loads", s.LocalLoads)
+	}
+
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+	time.Sleep(30 * time.Millisecond)
+	release <- struct{}{}
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "v2" {
+		t.Fatalf("stale Get = %q, %v, want v2", v, err)
+	}
+	waitFor(t, "failed refresh", func() bool { return gee.Stats().LocalLoadErrs == 1 })
+	close(release)
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "v2" {
+		t.Fatalf("failed refresh should keep the stale value, got %q, %v", v, err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if _, err := gee.Get("Tom"); err == nil {
+		t.Fatalf("value past its hard expiry should not be served")
+	}
+
+	remote := NewGroup("stale-remote", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key + "@local"), nil
+		}))
+	remote.RegisterPeers(&fakePicker{peer: &fakePeer{}})
+	remote.mainCache.add("Tom", ByteView{b: []byte("old"), s: time.Now().Add(-time.Second)})
+	if v, err := remote.Get("Tom"); err != nil || v.String() != "old" {
+		t.Fatalf("stale Get = %q, %v, want old", v, err)
+	}
+	waitFor(t, "refreshed value from peer", func() bool {
+		v, _ := remote.mainCache.peek("Tom")
+		return v.String() == "Tom@peer"
+	})
+}
+
+// 测试以 Reader 返回缓存值的回调函数和缓存值的长度限制
+// 测试步骤
+//  1. 长度已知和未知(以 ? 开头的 key)时都能读出完整的缓存值
+//  2. 超过 WithMaxValueBytes 的缓存值返回 ErrValueTooLarge，不会被缓存
+//  3. Set 写入过长的值返回 ErrValueTooLarge
+//  4. BatchGetter 批量加载的值同样检查长度
+func TestReaderGetter(t *testing.T) {
+	var loads sync.Map
+	g := NewGroup("reader", 2<<10, ReaderGetterFunc(
+		func(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+			n, _ := loads.LoadOrStore(key, new(int))
+			*n.(*int)++
+			value := strings.Repeat(key, 4)
+			size := int64(len(value))
+			if strings.HasPrefix(key, "?") {
+				size = -1
+			}
+			return io.NopCloser(strings.NewReader(value)), size, nil
+		}), WithMaxValueBytes(16))
+
+	for _, key := range []string{"Tom", "?ab"} {
+		if v, err := g.Get(key); err != nil || v.String() != strings.Repeat(key, 4) {
+			t.Fatalf("Get(%s) = %q, %v", key, v, err)
+		}
+	}
+	for _, key := range []string{"toolarge", "?toolarge"} {
+		for i := 0; i < 2; i++ {
+			if _, err := g.Get(key); !errors.Is(err, ErrValueTooLarge) {
+				t.Fatalf("Get(%s): expect ErrValueTooLarge, got %v", key, err)
+			}
+		}
+		if n, _ := loads.Load(key); *n.(*int) != 2 {
+			t.Fatalf("Get(%s): too large values should not be cached, loaded %d times", key, *n.(*int))
+		}
+	}
+	if err := g.Set("Jack", bytes.Repeat([]byte{'x'}, 17)); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("Set: expect ErrValueTooLarge, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	v, _ := g.Get("Tom")
+	if _, err := v.WriteTo(&buf); err != nil || buf.String() != "TomTomTomTom" {
+		t.Fatalf("WriteTo = %q, %v", buf.String(), err)
+	}
+
+	batch := NewGroup("reader-batch", 2<<10, BatchGetterFunc(
+		func(ctx context.Context, keys []string) (map[string][]byte, error) {
+			values := make(map[string][]byte)
+			for _, key := range keys {
+				values[key] = []byte(strings.Repeat(key, 4))
+			}
+			return values, nil
+		}), WithMaxValueBytes(16))
+	values, err := batch.GetMulti(context.Background(), []string{"Tom", "toolarge"})
+	if !errors.Is(err, ErrValueTooLarge) || len(values) != 1 || values["Tom"].String() != "TomTomTomTom" {
+		t.Fatalf("GetMulti = %v, %v", values, err)
+	}
+	if _, ok := batch.mainCache.get("toolarge"); ok {
+		t.Fatalf("too large batch values should not be cached")
+	}
+}
@@ -0,0 +1,317 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// GRPCPool 基于 gRPC 的节点池，实现 geecachepb.proto 中定义的 GroupCache 服务。
+// 与 HTTPPool 一样用一致性哈希选择节点，节点之间复用 HTTP/2 长连接
+type GRPCPool struct {
+	// 用来记录自己的地址，格式为 host:port
+	self string
+	// 锁
+	mu sync.Mutex
+	// 一致性哈希算法匹配机制，用来根据具体的 key 选择节点
+	peers *consistenthash.Map
+	// 映射远程节点与对应的 grpcGetter
+	grpcGetters map[string]*grpcGetter
+	// 单个缓存值的最大长度，0 表示不限制
+	maxValue int64
+}
+
+// GRPCPoolOptions GRPCPool 的可选配置
+type GRPCPoolOptions struct {
+	// 节点间传输的单个缓存值的最大长度，默认是 64MB，小于 0 表示不限制。
+	// 与 HTTPPool 相同，超过时返回 ErrValueTooLarge，gRPC 消息的大小上限也随之设置
+	MaxValueBytes int64
+}
+
+type grpcGetter struct {
+	addr string
+	conn *grpc.ClientConn
+	// 由 conn 创建的客户端，多个请求共用同一个连接
+	client pb.GroupCacheClient
+	// 接收的缓存值的最大长度，0 表示不限制
+	maxValue int64
+}
+
+func newGRPCGetter(addr string, maxValue int64) (*grpcGetter, error) {
+	limit := grpcMsgLimit(maxValue)
+	conn, err := grpc.NewClient(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(limit), grpc.MaxCallSendMsgSize(limit)))
+	if err != nil {
+		return nil, err
+	}
+	return &grpcGetter{addr: addr, conn: conn, client: pb.NewGroupCacheClient(conn), maxValue: maxValue}, nil
+}
+
+// gRPC 消息的大小上限，在缓存值的最大长度上留出其余字段的空间
+func grpcMsgLimit(maxValue int64) int {
+	if maxValue <= 0 || maxValue > math.MaxInt32-maxResponseOverhead {
+		return math.MaxInt32
+	}
+	return int(maxValue + maxResponseOverhead)
+}
+
+// 节点间的请求带有该 metadata，接收方只在本地加载，不再转发
+const fromPeerMetadata = "geecache-from-peer"
+
+// 标记请求来自其他节点
+func peerContext(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, fromPeerMetadata, "1")
+}
+
+// 其他节点发来的请求只在本地加载
+func serverContext(ctx context.Context) context.Context {
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(fromPeerMetadata)) > 0 {
+		return withLocalOnly(ctx)
+	}
+	return ctx
+}
+
+// 超过消息大小上限的请求或响应被 gRPC 以 ResourceExhausted 拒绝，转换为 ErrValueTooLarge
+func grpcError(err error) error {
+	if status.Code(err) == codes.ResourceExhausted {
+		return fmt.Errorf("%w: %s", ErrValueTooLarge, status.Convert(err).Message())
+	}
+	return err
+}
+
+func (g *grpcGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	res, err := g.client.Get(peerContext(ctx), in)
+	if err != nil {
+		return grpcError(err)
+	}
+	if g.maxValue > 0 && int64(len(res.Value)) > g.maxValue {
+		return fmt.Errorf("%w: %d bytes", ErrValueTooLarge, len(res.Value))
+	}
+	proto.Merge(out, res)
+	return nil
+}
+
+func (g *grpcGetter) Set(ctx context.Context, in *pb.SetRequest, out *pb.Response) error {
+	if g.maxValue > 0 && int64(len(in.Value)) > g.maxValue {
+		return fmt.Errorf("%w: %d bytes", ErrValueTooLarge, len(in.Value))
+	}
+	res, err := g.client.Set(ctx, in)
+	if err != nil {
+		return grpcError(err)
+	}
+	proto.Merge(out, res)
+	return nil
+}
+
+func (g *grpcGetter) Remove(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	res, err := g.client.Remove(ctx, in)
+	if err != nil {
+		return grpcError(err)
+	}
+	proto.Merge(out, res)
+	return nil
+}
+
+func (g *grpcGetter) peerAddr() string {
+	return g.addr
+}
+
+func (g *grpcGetter) GetMulti(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	res, err := g.client.GetMulti(peerContext(ctx), in)
+	if err != nil {
+		return grpcError(err)
+	}
+	proto.Merge(out, res)
+	return nil
+}
+
+var (
+	_ PeerGetter      = (*grpcGetter)(nil)
+	_ BatchPeerGetter = (*grpcGetter)(nil)
+)
+
+func NewGRPCPool(self string) *GRPCPool {
+	return NewGRPCPoolOpts(self, nil)
+}
+
+// NewGRPCPoolOpts 使用指定的配置创建 GRPCPool，opts 为 nil 时与 NewGRPCPool 相同
+func NewGRPCPoolOpts(self string, opts *GRPCPoolOptions) *GRPCPool {
+	var o GRPCPoolOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxValueBytes == 0 {
+		o.MaxValueBytes = defaultMaxValueBytes
+	}
+	return &GRPCPool{self: self, maxValue: max(o.MaxValueBytes, 0)}
+}
+
+// Set 重新设置节点，旧节点的连接会被关闭
+func (p *GRPCPool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.peers = consistenthash.New(defaultReplicas, nil)
+	p.peers.Add(peers...)
+	old := p.grpcGetters
+	p.grpcGetters = make(map[string]*grpcGetter, len(peers))
+	for _, peer := range peers {
+		if getter, ok := old[peer]; ok {
+			p.grpcGetters[peer] = getter
+			delete(old, peer)
+			continue
+		}
+		getter, err := newGRPCGetter(peer, p.maxValue)
+		if err != nil {
+			p.Log("connect peer %s: %v", peer, err)
+			continue
+		}
+		p.grpcGetters[peer] = getter
+	}
+	for _, getter := range old {
+		getter.conn.Close()
+	}
+}
+
+func (p *GRPCPool) PickPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
+	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+		if getter, ok := p.grpcGetters[peer]; ok {
+			p.Log("Pick peer %s", peer)
+			return getter, true
+		}
+	}
+	return nil, false
+}
+
+// GetAll 返回除自身以外的所有远程节点
+func (p *GRPCPool) GetAll() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var peers []PeerGetter
+	for peer, getter := range p.grpcGetters {
+		if peer != p.self {
+			peers = append(peers, getter)
+		}
+	}
+	return peers
+}
+
+var _ PeerPicker = (*GRPCPool)(nil)
+
+func (p *GRPCPool) Log(format string, v ...interface{}) {
+	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+}
+
+// NewServer 创建 gRPC 服务端并注册 GroupCache 服务，消息大小上限由 MaxValueBytes 决定，
+// opts 中的同类选项会覆盖它
+func (p *GRPCPool) NewServer(opts ...grpc.ServerOption) *grpc.Server {
+	limit := grpcMsgLimit(p.maxValue)
+	opts = append([]grpc.ServerOption{grpc.MaxRecvMsgSize(limit), grpc.MaxSendMsgSize(limit)}, opts...)
+	s := grpc.NewServer(opts...)
+	pb.RegisterGroupCacheServer(s, &grpcServer{pool: p})
+	return s
+}
+
+// grpcServer GroupCache 服务的服务端实现
+type grpcServer struct {
+	pb.UnimplementedGroupCacheServer
+	pool *GRPCPool
+}
+
+// 根据缓存组名获取缓存组
+func lookupGroup(name string) (*Group, error) {
+	group := GetGroup(name)
+	if group == nil {
+		return nil, status.Errorf(codes.NotFound, "no such group: %s", name)
+	}
+	return group, nil
+}
+
+// Get 服务端获取缓存值
+func (s *grpcServer) Get(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+	s.pool.Log("Get %s/%s", in.GetGroup(), in.GetKey())
+	group, err := lookupGroup(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	// 请求方的截止时间由 gRPC 通过 ctx 传递
+	view, err := group.GetContext(serverContext(ctx), in.GetKey())
+	if errors.Is(err, ErrNotFound) {
+		return &pb.Response{Status: pb.Status_NOT_FOUND}, nil
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return nil, status.FromContextError(err).Err()
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if s.pool.maxValue > 0 && int64(view.Len()) > s.pool.maxValue {
+		return nil, status.Errorf(codes.ResourceExhausted, "%s: value of %d bytes exceeds %d", in.GetKey(), view.Len(), s.pool.maxValue)
+	}
+	res := &pb.Response{Value: view.ByteSlice()}
+	if expire := view.Expire(); !expire.IsZero() {
+		res.Expire = expire.UnixNano()
+	}
+	return res, nil
+}
+
+// Set 服务端写入缓存值，只保存在本地
+func (s *grpcServer) Set(ctx context.Context, in *pb.SetRequest) (*pb.Response, error) {
+	s.pool.Log("Set %s/%s", in.GetGroup(), in.GetKey())
+	group, err := lookupGroup(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	if s.pool.maxValue > 0 && int64(len(in.Value)) > s.pool.maxValue {
+		return nil, status.Errorf(codes.ResourceExhausted, "%s: value of %d bytes exceeds %d", in.GetKey(), len(in.Value), s.pool.maxValue)
+	}
+	var expire time.Time
+	if in.Expire != 0 {
+		expire = time.Unix(0, in.Expire)
+	}
+	group.localSet(in.GetKey(), ByteView{b: cloneBytes(in.Value), e: expire})
+	return &pb.Response{}, nil
+}
+
+// Remove 服务端删除缓存值，只从本地删除
+func (s *grpcServer) Remove(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+	s.pool.Log("Remove %s/%s", in.GetGroup(), in.GetKey())
+	group, err := lookupGroup(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	group.localRemove(in.GetKey())
+	return &pb.Response{}, nil
+}
+
+// GetMulti 服务端批量获取缓存值，每个 key 的错误放在对应的 BatchEntry 中
+func (s *grpcServer) GetMulti(ctx context.Context, in *pb.BatchRequest) (*pb.BatchResponse, error) {
+	s.pool.Log("GetMulti %s (%d keys)", in.GetGroup(), len(in.GetKeys()))
+	group, err := lookupGroup(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	res, err := group.batchResponse(serverContext(ctx), in.GetKeys())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return res, nil
+}
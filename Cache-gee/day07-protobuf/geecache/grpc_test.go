@@ -0,0 +1,93 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	pb "geecache/geecachepb"
+	"net"
+	"strings"
+	"testing"
+)
+
+func init() {
+	transports["grpc"] = peerTransport{
+		name: "grpc",
+		addr: func(hostport string) string { return hostport },
+		newPool: func(self string, peers []string) (PeerPicker, func(string) string) {
+			pool := NewGRPCPool(self)
+			pool.Set(peers...)
+			return pool, pool.peers.Get
+		},
+		getter: func(t *testing.T, addr string) PeerGetter {
+			getter, err := newGRPCGetter(addr, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { getter.conn.Close() })
+			return getter
+		},
+		serve: func(self string, peers PeerPicker) error {
+			l, err := net.Listen("tcp", self)
+			if err != nil {
+				return err
+			}
+			return peers.(*GRPCPool).NewServer().Serve(l)
+		},
+	}
+}
+
+func TestGRPCPool(t *testing.T) {
+	testPeers(t, transports["grpc"])
+}
+
+// 测试 gRPC 传输的缓存值长度限制
+// 测试步骤
+//  1. 服务端的 MaxValueBytes 小于缓存值时拒绝发送，请求方得到 ErrValueTooLarge
+//  2. 请求方的 MaxValueBytes 小于缓存值时拒绝接收
+//  3. 过长的 Set 和 Remove 请求被请求方或服务端拒绝
+func TestGRPCMaxValueBytes(t *testing.T) {
+	NewGroup("grpc-limit", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(strings.Repeat(key, 4)), nil
+		}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewGRPCPoolOpts(l.Addr().String(), &GRPCPoolOptions{MaxValueBytes: 16}).NewServer()
+	go srv.Serve(l)
+	defer srv.Stop()
+	getter := func(maxValue int64) PeerGetter {
+		g, err := newGRPCGetter(l.Addr().String(), maxValue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { g.conn.Close() })
+		return g
+	}
+	ctx := context.Background()
+
+	unlimited := getter(0)
+	res := &pb.Response{}
+	if err := unlimited.Get(ctx, &pb.Request{Group: "grpc-limit", Key: "Tom"}, res); err != nil || string(res.Value) != "TomTomTomTom" {
+		t.Fatalf("Get(Tom) = %q, %v", res.Value, err)
+	}
+	if err := unlimited.Get(ctx, &pb.Request{Group: "grpc-limit", Key: "toolarge"}, &pb.Response{}); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("server limit: expect ErrValueTooLarge, got %v", err)
+	}
+	if err := getter(8).Get(ctx, &pb.Request{Group: "grpc-limit", Key: "Tom"}, &pb.Response{}); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("client limit: expect ErrValueTooLarge, got %v", err)
+	}
+
+	big := &pb.SetRequest{Group: "grpc-limit", Key: "Jack", Value: make([]byte, 32)}
+	if err := getter(8).Set(ctx, big, &pb.Response{}); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("client Set limit: expect ErrValueTooLarge, got %v", err)
+	}
+	if err := unlimited.Set(ctx, big, &pb.Response{}); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("server Set limit: expect ErrValueTooLarge, got %v", err)
+	}
+	long := &pb.Request{Group: "grpc-limit", Key: strings.Repeat("k", 1<<10)}
+	if err := getter(8).Remove(ctx, long, &pb.Response{}); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("client Remove limit: expect ErrValueTooLarge, got %v", err)
+	}
+}
@@ -1,15 +1,23 @@
 package geecache
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"geecache/consistenthash"
 	pb "geecache/geecachepb"
+	"io"
 	"io/ioutil"
 	"log"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 
 	"google.golang.org/protobuf/proto"
 )
@@ -17,6 +25,28 @@ import (
 const (
 	defaultBasePath = "/_geecache/"
 	defaultReplicas = 50
+	// Prometheus 抓取统计信息的路径
+	defaultMetricsPath = "/metrics"
+	// 请求方剩余的超时时间，格式与 time.ParseDuration 相同
+	timeoutHeader = "X-Geecache-Timeout"
+	// 节点间的请求带有该请求头，接收方只在本地加载，不再转发
+	fromPeerHeader = "X-Geecache-From-Peer"
+	// 批量获取使用 POST <basePath><group>/_batch
+	batchKey = "_batch"
+	// 批量请求的请求体上限
+	maxBatchRequestBytes = 4 << 20
+
+	// 节点间请求的默认配置
+	defaultPeerTimeout         = 3 * time.Second
+	defaultRetries             = 2
+	defaultRetryBackoff        = 20 * time.Millisecond
+	defaultBreakerThreshold    = 5
+	defaultBreakerCooldown     = 5 * time.Second
+	defaultMaxIdleConnsPerHost = 64
+	defaultMaxValueBytes       = 64 << 20
+	defaultStreamThreshold     = 1 << 20
+	// 不分块的响应中除缓存值以外的部分允许的长度
+	maxResponseOverhead = 1 << 10
 )
 
 type HTTPPool struct {
@@ -27,44 +57,208 @@ type HTTPPool struct {
 	// 锁
 	mu sync.Mutex
 	// 一致性哈希算法匹配机制，用来根据具体的 key 选择节点
-	peers *consistenthash.Map
+	peers consistenthash.Ring
+	// 创建节点选择算法
+	newRing func() consistenthash.Ring
+	// 是否按有界负载选择节点
+	bounded bool
+	// 节点间请求的配置
+	opts HTTPPoolOptions
 	// 映射远程节点与对应的 httpGetter。
 	// 每一个远程节点对应一个 httpGetter，
 	// 因为 httpGetter 与远程节点的地址 baseURL 有关。
 	httpGetters map[string]*httpGetter
+	// 集群中的所有节点及其健康状态
+	members map[string]*member
+	// 关闭时停止健康检查
+	stopHealth chan struct{}
+	// 管理接口，位于 <basePath>_admin 下
+	admin http.Handler
 }
 
 type httpGetter struct {
 	baseURL string
+	client  *http.Client
+	// 每次请求的超时时间，0 表示不限制
+	timeout time.Duration
+	// 失败后的重试次数和第一次重试前的等待时间
+	retries int
+	backoff time.Duration
+	breaker *breaker
+	// 请求签名的密钥，为空时不签名
+	secret []byte
+	// 接收的缓存值的最大长度，0 表示不限制
+	maxValue int64
+}
+
+// 为远程节点创建 httpGetter，每个节点有独立的熔断器
+func (p *HTTPPool) newGetter(peer string) *httpGetter {
+	return &httpGetter{
+		baseURL:  peer + p.basePath,
+		client:   p.opts.Client,
+		timeout:  max(p.opts.Timeout, 0),
+		retries:  max(p.opts.Retries, 0),
+		backoff:  p.opts.RetryBackoff,
+		breaker:  newBreaker(p.opts.BreakerThreshold, p.opts.BreakerCooldown),
+		secret:   p.opts.Secret,
+		maxValue: max(p.opts.MaxValueBytes, 0),
+	}
 }
 
 // Get方法用于实现远程节点的客户端，发出请求获取返回信息
-func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
-	// 拼接URL，通过 http.Get() 发起请求
+func (h *httpGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return h.do(ctx, http.MethodGet, in.GetGroup(), in.GetKey(), nil, out)
+}
+
+// Set 通过 PUT 请求将缓存值写入远程节点
+func (h *httpGetter) Set(ctx context.Context, in *pb.SetRequest, out *pb.Response) error {
+	if h.maxValue > 0 && int64(len(in.Value)) > h.maxValue {
+		return fmt.Errorf("%w: %d bytes", ErrValueTooLarge, len(in.Value))
+	}
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("encoding request body: %v", err)
+	}
+	return h.do(ctx, http.MethodPut, in.GetGroup(), in.GetKey(), body, out)
+}
+
+// Remove 通过 DELETE 请求删除远程节点的缓存值
+func (h *httpGetter) Remove(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return h.do(ctx, http.MethodDelete, in.GetGroup(), in.GetKey(), nil, out)
+}
+
+func (h *httpGetter) peerAddr() string {
+	return h.baseURL
+}
+
+// GetMulti 通过 POST 请求从远程节点批量获取缓存值
+func (h *httpGetter) GetMulti(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("encoding request body: %v", err)
+	}
+	return h.do(ctx, http.MethodPost, in.GetGroup(), batchKey, body, out)
+}
+
+// 向远程节点发起请求，并将返回的 proto 消息解码到 out 中。
+// 网络错误和网关类错误会按指数退避重试，最终失败计入熔断器
+func (h *httpGetter) do(ctx context.Context, method, group, key string, body []byte, out proto.Message) error {
+	if !h.breaker.allow() {
+		return ErrCircuitOpen
+	}
+	// 拼接URL：<baseURL><group>/<key>
 	u := fmt.Sprintf(
-		"%v%v%v",
+		"%v%v/%v",
 		h.baseURL,
-		url.QueryEscape(in.GetGroup()),
-		url.QueryEscape(in.GetKey()),
+		url.PathEscape(group),
+		url.PathEscape(key),
+	)
+	var (
+		retry bool
+		err   error
 	)
-	res, err := http.Get(u)
+	for attempt := 0; ; attempt++ {
+		retry, err = h.try(ctx, method, u, body, out)
+		if err == nil || !retry || attempt >= h.retries || !h.wait(ctx, attempt) {
+			break
+		}
+	}
+	switch {
+	case err == nil:
+		h.breaker.success()
+	case ctx.Err() != nil:
+		// 调用方取消或超时导致的失败，不能说明节点有问题
+		h.breaker.abort()
+	case retry:
+		h.breaker.failure()
+	default:
+		h.breaker.success()
+	}
+	return err
+}
+
+// 第 attempt 次重试前等待，等待时间每次翻倍，并在 [d/2, d] 之间随机抖动，
+// 避免多个节点同时重试。ctx 结束时返回 false
+func (h *httpGetter) wait(ctx context.Context, attempt int) bool {
+	d := h.backoff << attempt
+	d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// 发起一次请求，返回的 retry 表示失败原因是否在节点一侧，可以重试。
+// ctx 的截止时间以相对时间放在请求头中，避免依赖两个节点的时钟同步
+func (h *httpGetter) try(ctx context.Context, method, u string, body []byte, out proto.Message) (retry bool, err error) {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
 	if err != nil {
-		return err
+		return false, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set(timeoutHeader, time.Until(deadline).String())
+	}
+	req.Header.Set(fromPeerHeader, "1")
+	if len(h.secret) > 0 {
+		SignRequest(req, h.secret, body)
+	}
+	// 单个缓存值较大时节点会分块传输
+	single, _ := out.(*pb.Response)
+	if single != nil && method == http.MethodGet {
+		req.Header.Set("Accept", streamContentType+", application/octet-stream")
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return true, err
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned: %v", res.Status)
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true, fmt.Errorf("server returned: %v", res.Status)
+	case http.StatusRequestEntityTooLarge:
+		return false, fmt.Errorf("%w: server returned: %v", ErrValueTooLarge, res.Status)
+	default:
+		// 节点正常响应了错误，重试也不会成功
+		return false, fmt.Errorf("server returned: %v", res.Status)
 	}
 
-	bytes, err := ioutil.ReadAll(res.Body)
+	if single != nil && res.Header.Get("Content-Type") == streamContentType {
+		if err := readStream(res.Body, single, h.maxValue); err != nil {
+			// 传输中断或数据损坏时可以重试
+			retry := errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, ErrChecksum)
+			return retry, fmt.Errorf("reading response body: %w", err)
+		}
+		return false, nil
+	}
+	src := io.Reader(res.Body)
+	if single != nil && h.maxValue > 0 {
+		src = io.LimitReader(res.Body, h.maxValue+maxResponseOverhead+1)
+	}
+	bytes, err := ioutil.ReadAll(src)
 	if err != nil {
-		return fmt.Errorf("reading response body: %v", err)
+		return true, fmt.Errorf("reading response body: %v", err)
+	}
+	if single != nil && h.maxValue > 0 && int64(len(bytes)) > h.maxValue+maxResponseOverhead {
+		return false, fmt.Errorf("%w: response larger than %d bytes", ErrValueTooLarge, h.maxValue)
 	}
 	if err = proto.Unmarshal(bytes, out); err != nil {
-		return fmt.Errorf("reading response body: %v", err)
+		return false, fmt.Errorf("reading response body: %v", err)
+	}
+	if single != nil && h.maxValue > 0 && int64(len(single.Value)) > h.maxValue {
+		return false, fmt.Errorf("%w: %d bytes", ErrValueTooLarge, len(single.Value))
 	}
-	return nil
+	return false, nil
 }
 
 // 该行代码是一个类型断言，
@@ -72,22 +266,84 @@ func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
 // 目的是为了检查httpGetter类型是否实现了PeerGetter接口。
 // 如果实现了，该行代码不会报错；如果没有实现，则会编译失败。
 // ，以确保代码的正确性和健壮性。
-var _ PeerGetter = (*httpGetter)(nil)
+var (
+	_ PeerGetter      = (*httpGetter)(nil)
+	_ BatchPeerGetter = (*httpGetter)(nil)
+)
 
+// Set 重新设置集群中的全部节点，所有节点初始都是健康的
 func (p *HTTPPool) Set(peers ...string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.peers = consistenthash.New(defaultReplicas, nil)
-	p.peers.Add(peers...)
+	old := p.httpGetters
+	p.members = make(map[string]*member, len(peers))
 	p.httpGetters = make(map[string]*httpGetter, len(peers))
 	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+		p.members[peer] = &member{alive: true, weight: 1}
+		// 保留已有节点的熔断器状态
+		if getter, ok := old[peer]; ok {
+			p.httpGetters[peer] = getter
+			continue
+		}
+		p.httpGetters[peer] = p.newGetter(peer)
 	}
+	p.rebuild()
 }
 
+// PickPeer 选择处理 key 的远程节点。启用有界负载时，
+// 负载已满的节点会把 key 交给哈希环上的下一个节点，返回的 PeerGetter 在请求结束后释放负载
 func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	ring, ok := p.peers.(consistenthash.BoundedRing)
+	if !p.bounded || !ok {
+		// 熔断器打开时直接在本地加载，不等待宕机的节点
+		if getter, ok := p.pickOwner(key); ok && getter.breaker.ready() {
+			return getter, true
+		}
+		return nil, false
+	}
+	// 本节点自身的负载不经过 PickPeer，不计入负载
+	if peer := ring.GetLeast(key); peer != "" && peer != p.self && p.httpGetters[peer].breaker.ready() {
+		p.Log("Pick peer %s", peer)
+		ring.Inc(peer)
+		return &boundedGetter{
+			PeerGetter: p.httpGetters[peer],
+			done: func() {
+				p.mu.Lock()
+				defer p.mu.Unlock()
+				ring.Done(peer)
+			},
+		}, true
+	}
+	return nil, false
+}
+
+// PickOwner 返回哈希环上负责 key 的远程节点，不考虑负载
+func (p *HTTPPool) PickOwner(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if getter, ok := p.pickOwner(key); ok {
+		return getter, true
+	}
+	return nil, false
+}
+
+// Owner 返回哈希环上负责 key 的节点地址，可能是自身，没有节点时返回空字符串
+func (p *HTTPPool) Owner(key string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return ""
+	}
+	return p.peers.Get(key)
+}
+
+// 调用方需持有锁
+func (p *HTTPPool) pickOwner(key string) (*httpGetter, bool) {
+	if p.peers == nil {
+		return nil, false
+	}
 	if peer := p.peers.Get(key); peer != "" && peer != p.self {
 		p.Log("Pick peer %s", peer)
 		return p.httpGetters[peer], true
@@ -95,24 +351,219 @@ func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
 	return nil, false
 }
 
+// boundedGetter 包装远程节点，每次请求结束后释放 PickPeer 时占用的负载
+type boundedGetter struct {
+	PeerGetter
+	once sync.Once
+	done func()
+}
+
+func (b *boundedGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	defer b.once.Do(b.done)
+	return b.PeerGetter.Get(ctx, in, out)
+}
+
+func (b *boundedGetter) Set(ctx context.Context, in *pb.SetRequest, out *pb.Response) error {
+	defer b.once.Do(b.done)
+	return b.PeerGetter.Set(ctx, in, out)
+}
+
+func (b *boundedGetter) Remove(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	defer b.once.Do(b.done)
+	return b.PeerGetter.Remove(ctx, in, out)
+}
+
+// GetMulti 转发批量请求，被包装的 httpGetter 总是支持批量请求
+func (b *boundedGetter) GetMulti(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	defer b.once.Do(b.done)
+	return b.PeerGetter.(BatchPeerGetter).GetMulti(ctx, in, out)
+}
+
+func (b *boundedGetter) peerAddr() string {
+	return b.PeerGetter.(peerAddresser).peerAddr()
+}
+
+func (b *boundedGetter) release() {
+	b.once.Do(b.done)
+}
+
+// GetAll 返回除自身以外的所有健康的远程节点
+func (p *HTTPPool) GetAll() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var peers []PeerGetter
+	for peer, getter := range p.httpGetters {
+		if peer != p.self && p.members[peer].alive {
+			peers = append(peers, getter)
+		}
+	}
+	return peers
+}
+
 var _ PeerPicker = (*HTTPPool)(nil)
 
+// HTTPPoolOptions HTTPPool 的配置项，零值字段使用默认值
+type HTTPPoolOptions struct {
+	// 节点间通讯地址的前缀，默认是 /_geecache/
+	BasePath string
+	// 一致性哈希的虚拟节点倍数，默认是 50
+	Replicas int
+	// 一致性哈希使用的哈希算法，默认是 crc32
+	HashFn consistenthash.Hash
+	// 创建节点选择算法，例如 consistenthash.NewRendezvous，
+	// 默认是 consistenthash.NewBounded(Replicas, BoundedLoad, HashFn)
+	NewRing func() consistenthash.Ring
+	// 有界负载的参数 ε，大于 0 时每个节点正在处理的请求数不超过平均值的 1+ε 倍，
+	// 节点选择算法需要实现 consistenthash.BoundedRing
+	BoundedLoad float64
+	// 节点间请求使用的 http.Client，默认使用加大了空闲连接数的 Client
+	Client *http.Client
+	// 每次请求的超时时间，默认是 3s，小于 0 表示不限制
+	Timeout time.Duration
+	// 网络错误等可重试的失败后的重试次数，默认是 2，小于 0 表示不重试
+	Retries int
+	// 第一次重试前的等待时间，之后每次翻倍并加入随机抖动，默认是 20ms
+	RetryBackoff time.Duration
+	// 连续失败多少次后打开节点的熔断器，默认是 5
+	BreakerThreshold int
+	// 熔断器打开后多久放行试探请求，默认是 5s
+	BreakerCooldown time.Duration
+	// 节点间通讯的 TLS 配置，同时用于 Serve 的监听端和默认 Client，
+	// 为 nil 时使用明文 HTTP。可以用 LoadTLSConfig 创建 mTLS 配置
+	TLSConfig *tls.Config
+	// 节点间共享的密钥，不为空时所有请求都用 HMAC-SHA256 签名，
+	// ServeHTTP 拒绝签名不正确的请求，健康检查和统计信息除外。
+	// 为空时成员接口只能查看，不能添加、删除节点
+	Secret []byte
+	// 节点间传输的单个缓存值的最大长度，默认是 64MB，小于 0 表示不限制。
+	// 发送方拒绝发送、接收方拒绝接收更长的值，返回 ErrValueTooLarge
+	MaxValueBytes int64
+	// 不小于该长度的缓存值分块传输，每块带有校验和，默认是 1MB，小于 0 表示不分块
+	StreamThreshold int64
+}
+
 func NewHTTPPool(self string) *HTTPPool {
+	return NewHTTPPoolOpts(self, nil)
+}
+
+// NewHTTPPoolOpts 使用指定的配置创建 HTTPPool，opts 为 nil 时与 NewHTTPPool 相同
+func NewHTTPPoolOpts(self string, opts *HTTPPoolOptions) *HTTPPool {
+	var o HTTPPoolOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.BasePath == "" {
+		o.BasePath = defaultBasePath
+	}
+	if o.Replicas == 0 {
+		o.Replicas = defaultReplicas
+	}
+	if o.NewRing == nil {
+		o.NewRing = func() consistenthash.Ring {
+			return consistenthash.NewBounded(o.Replicas, o.BoundedLoad, o.HashFn)
+		}
+	}
+	if o.Client == nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		// 默认每个节点只保留 2 个空闲连接，并发请求多时会频繁建立新连接
+		t.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+		if o.TLSConfig != nil {
+			t.TLSClientConfig = o.TLSConfig.Clone()
+		}
+		o.Client = &http.Client{Transport: t}
+	}
+	if o.Timeout == 0 {
+		o.Timeout = defaultPeerTimeout
+	}
+	if o.Retries == 0 {
+		o.Retries = defaultRetries
+	}
+	if o.RetryBackoff == 0 {
+		o.RetryBackoff = defaultRetryBackoff
+	}
+	if o.BreakerThreshold == 0 {
+		o.BreakerThreshold = defaultBreakerThreshold
+	}
+	if o.BreakerCooldown == 0 {
+		o.BreakerCooldown = defaultBreakerCooldown
+	}
+	if o.MaxValueBytes == 0 {
+		o.MaxValueBytes = defaultMaxValueBytes
+	}
+	if o.StreamThreshold == 0 {
+		o.StreamThreshold = defaultStreamThreshold
+	}
 	return &HTTPPool{
 		self:     self,
-		basePath: defaultBasePath,
+		basePath: o.BasePath,
+		newRing:  o.NewRing,
+		bounded:  o.BoundedLoad > 0,
+		opts:     o,
+		admin:    NewAdminHandler(o.BasePath + defaultAdminPath),
 	}
 }
 
+// ListenAndServe 在 addr 上监听并处理节点间请求，配置了 TLSConfig 时使用 TLS
+func (p *HTTPPool) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return p.Serve(l)
+}
+
+// Serve 在 l 上处理节点间请求，配置了 TLSConfig 时使用 TLS
+func (p *HTTPPool) Serve(l net.Listener) error {
+	srv := &http.Server{Handler: p, TLSConfig: p.opts.TLSConfig}
+	if p.opts.TLSConfig != nil {
+		// 证书已在 TLSConfig 中
+		return srv.ServeTLS(l, "", "")
+	}
+	return srv.Serve(l)
+}
+
 func (p *HTTPPool) Log(format string, v ...interface{}) {
 	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
 }
 
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == defaultMetricsPath {
+		p.serveMetrics(w, r)
+		return
+	}
 	// 判断请求是否以基路径（p.basePath）开头
 	if !strings.HasPrefix(r.URL.Path, p.basePath) {
 		panic("HTTPPool serving unexpected path: " + r.URL.Path)
 	}
+	// 健康检查不需要签名
+	if r.URL.Path[len(p.basePath):] == defaultHealthPath {
+		w.Write([]byte("ok"))
+		return
+	}
+	if len(p.opts.Secret) > 0 {
+		var maxBody int64
+		if p.opts.MaxValueBytes > 0 {
+			maxBody = p.opts.MaxValueBytes + maxResponseOverhead
+		}
+		if err := verifyRequest(w, r, p.opts.Secret, maxBody); err != nil {
+			p.Log("reject %s %s: %v", r.Method, r.URL.Path, err)
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+	switch rest := r.URL.Path[len(p.basePath):]; {
+	case rest == defaultMembersPath:
+		p.serveMembers(w, r)
+		return
+	case strings.HasPrefix(rest, defaultAdminPath+"/"):
+		p.admin.ServeHTTP(w, r)
+		return
+	}
 	p.Log("%s %s", r.Method, r.URL.Path)
 	// 请求格式：/<basepath>/<groupname>/<key>
 	// 分割出缓存组名和缓存键
@@ -130,18 +581,171 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
 		return
 	}
-	// 获取缓存值
-	view, err := group.Get(key)
+	switch r.Method {
+	case http.MethodGet:
+		p.serveGet(w, r, group, key)
+	case http.MethodPut:
+		p.serveSet(w, r, group, key)
+	case http.MethodDelete:
+		group.localRemove(key)
+		p.writeResponse(w, &pb.Response{})
+	case http.MethodPost:
+		if key != batchKey {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		p.serveGetMulti(w, r, group)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// 输出 Prometheus 文本格式的统计信息
+func (p *HTTPPool) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	WriteMetrics(w)
+}
+
+// 请求方断开连接时 r.Context() 会被取消，另外按请求头设置超时。
+// 其他节点发来的请求只在本地加载
+func requestContext(r *http.Request) (context.Context, context.CancelFunc, error) {
+	ctx := r.Context()
+	if r.Header.Get(fromPeerHeader) != "" {
+		ctx = withLocalOnly(ctx)
+	}
+	v := r.Header.Get(timeoutHeader)
+	if v == "" {
+		return ctx, func() {}, nil
+	}
+	timeout, err := time.ParseDuration(v)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, nil, fmt.Errorf("bad %s: %s", timeoutHeader, v)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, nil
+}
+
+// 获取缓存值
+func (p *HTTPPool) serveGet(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	ctx, cancel, err := requestContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice()})
+	defer cancel()
+	view, err := group.GetContext(ctx, key)
+	// 不存在的 key 是正常的结果，通过 Status 告知请求方
+	if errors.Is(err, ErrNotFound) {
+		p.writeResponse(w, &pb.Response{Status: pb.Status_NOT_FOUND})
+		return
+	}
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, context.DeadlineExceeded) {
+			code = http.StatusGatewayTimeout
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	if p.opts.MaxValueBytes > 0 && int64(view.Len()) > p.opts.MaxValueBytes {
+		http.Error(w, fmt.Sprintf("%v: %d bytes", ErrValueTooLarge, view.Len()), http.StatusRequestEntityTooLarge)
+		return
+	}
+	// 编码时不会修改 Value，不需要复制
+	res := &pb.Response{Value: view.b}
+	// 将过期时间告知请求方
+	if expire := view.Expire(); !expire.IsZero() {
+		res.Expire = expire.UnixNano()
+	}
+	if p.opts.StreamThreshold >= 0 && int64(view.Len()) >= p.opts.StreamThreshold &&
+		strings.Contains(r.Header.Get("Accept"), streamContentType) {
+		res.Value = nil
+		w.Header().Set("Content-Type", streamContentType)
+		if err := writeStream(w, res, view.b); err != nil {
+			p.Log("stream %s: %v", key, err)
+		}
+		return
+	}
+	p.writeResponse(w, res)
+}
+
+// 批量获取缓存值，请求体是 proto 编码的 BatchRequest，
+// 每个 key 的错误放在对应的 BatchEntry 中
+func (p *HTTPPool) serveGetMulti(w http.ResponseWriter, r *http.Request, group *Group) {
+	ctx, cancel, err := requestContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBatchRequestBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &pb.BatchRequest{}
+	if err = proto.Unmarshal(body, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res, err := group.batchResponse(ctx, req.Keys)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.writeResponse(w, res)
+}
+
+// 写入缓存值，请求体是 proto 编码的 SetRequest
+func (p *HTTPPool) serveSet(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	if p.opts.MaxValueBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, p.opts.MaxValueBytes+maxResponseOverhead)
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, ErrValueTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &pb.SetRequest{}
+	if err = proto.Unmarshal(body, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if p.opts.MaxValueBytes > 0 && int64(len(req.Value)) > p.opts.MaxValueBytes {
+		http.Error(w, ErrValueTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	var expire time.Time
+	if req.Expire != 0 {
+		expire = time.Unix(0, req.Expire)
+	}
+	group.localSet(key, ByteView{b: req.Value, e: expire})
+	p.writeResponse(w, &pb.Response{})
+}
+
+// 将 proto 编码后的响应写入响应体
+func (p *HTTPPool) writeResponse(w http.ResponseWriter, res proto.Message) {
+	body, err := proto.Marshal(res)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	// 返回缓存值
 	w.Header().Set("Content-Type", "application/octet-stream")
 	w.Write(body)
 }
@@ -0,0 +1,742 @@
+package geecache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
+	"hash/crc32"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestHTTPPool(t *testing.T) {
+	testPeers(t, transports["http"])
+}
+
+// 测试 /metrics 输出 Prometheus 文本格式的统计信息
+func TestMetrics(t *testing.T) {
+	gee := NewGroup("metrics", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	gee.Get("Tom")
+	gee.Get("Tom")
+
+	pool := NewHTTPPool("http://localhost:9999")
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("status %d, content type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		"# TYPE geecache_gets_total counter\n",
+		`geecache_gets_total{group="metrics"} 2` + "\n",
+		`geecache_hits_total{group="metrics"} 1` + "\n",
+		`geecache_local_loads_total{group="metrics"} 1` + "\n",
+		"# TYPE geecache_items gauge\n",
+		`geecache_items{group="metrics"} 1` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+// 等待 cond 成立，超时则测试失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// 测试集群成员管理和健康检查
+// 测试步骤
+//  1. 节点 B 的健康检查返回 503 后被移出哈希环，所有 key 都由自身负责
+//  2. 节点 B 恢复后重新加入哈希环
+//  3. 没有配置 Secret 时成员接口拒绝修改，只能查看
+func TestMembership(t *testing.T) {
+	var down atomic.Bool
+	peerB := NewHTTPPool("")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		peerB.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	self := "http://127.0.0.1:0"
+	pool := NewHTTPPool(self)
+	pool.Set(self, srv.URL)
+	pool.StartHealthCheck(10 * time.Millisecond)
+	defer pool.StopHealthCheck()
+
+	alive := func(addr string) bool {
+		for _, m := range pool.Members() {
+			if m.Addr == addr {
+				return m.Alive
+			}
+		}
+		return false
+	}
+	picksB := func() bool {
+		for i := 0; i < 100; i++ {
+			if _, ok := pool.PickPeer(fmt.Sprintf("key%d", i)); ok {
+				return true
+			}
+		}
+		return false
+	}
+	if !picksB() {
+		t.Fatal("expect some keys owned by the remote peer")
+	}
+
+	down.Store(true)
+	waitFor(t, "peer to be ejected", func() bool { return !alive(srv.URL) })
+	if picksB() || len(pool.GetAll()) != 0 {
+		t.Fatal("dead peer should be removed from the ring")
+	}
+
+	down.Store(false)
+	waitFor(t, "peer to recover", func() bool { return alive(srv.URL) })
+	if !picksB() {
+		t.Fatal("recovered peer should be back on the ring")
+	}
+
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest(http.MethodPost, defaultBasePath+defaultMembersPath+"?peer=http://c", nil))
+	if w.Code != http.StatusForbidden || len(pool.Members()) != 2 {
+		t.Fatalf("unsigned POST should be rejected, got %d with %d members", w.Code, len(pool.Members()))
+	}
+	pool.AddPeer("http://c")
+	w = httptest.NewRecorder()
+	pool.ServeHTTP(w, httptest.NewRequest(http.MethodGet, defaultBasePath+defaultMembersPath, nil))
+	var members []Member
+	if err := json.Unmarshal(w.Body.Bytes(), &members); err != nil || len(members) != 3 {
+		t.Fatalf("members after add = %v, %v", members, err)
+	}
+	if members[0].Addr != self || !members[0].Self {
+		t.Fatalf("members should be sorted and mark self, got %v", members)
+	}
+	pool.RemovePeer("http://c")
+	if n := len(pool.Members()); n != 2 {
+		t.Fatalf("%d members after remove, want 2", n)
+	}
+}
+
+// 测试 HTTPPool 使用自定义的基路径和节点选择算法，并按权重分配 key
+func TestHTTPPoolOpts(t *testing.T) {
+	self := "http://a"
+	pool := NewHTTPPoolOpts(self, &HTTPPoolOptions{
+		BasePath: "/cache/",
+		NewRing:  func() consistenthash.Ring { return consistenthash.NewRendezvous(nil) },
+	})
+	pool.Set(self, "http://b", "http://c")
+	pool.SetWeight("http://b", 3)
+
+	ring := consistenthash.NewRendezvous(nil)
+	ring.Add(self, "http://c")
+	ring.AddWeighted("http://b", 3)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		want := ring.Get(key)
+		peer, ok := pool.PickPeer(key)
+		if want == self {
+			if ok {
+				t.Fatalf("%s should be owned by self", key)
+			}
+			continue
+		}
+		if !ok || peer.(*httpGetter).baseURL != want+"/cache/" {
+			t.Fatalf("%s picked %v, want %s", key, peer, want)
+		}
+	}
+}
+
+// 测试 HTTPPool 的有界负载
+// 测试步骤
+//  1. 同一个热点 key 的 30 个请求都未结束，请求被分散到各节点，每个节点不超过负载上限
+//  2. PickOwner 始终返回哈希环上的负责节点
+//  3. 请求结束后热点 key 重新由负责节点处理
+func TestHTTPPoolBoundedLoad(t *testing.T) {
+	pool := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{BoundedLoad: 0.25})
+	peers := []string{"http://b", "http://c", "http://d"}
+	pool.Set(peers...)
+	owner, _ := pool.PickOwner("hot")
+
+	const n = 30
+	counts := make(map[PeerGetter]int)
+	var inflight []*boundedGetter
+	for i := 0; i < n; i++ {
+		peer, ok := pool.PickPeer("hot")
+		if !ok {
+			t.Fatal("expect a remote peer")
+		}
+		bg := peer.(*boundedGetter)
+		counts[bg.PeerGetter]++
+		inflight = append(inflight, bg)
+	}
+	if len(counts) != len(peers) {
+		t.Fatalf("hot key should spill to all %d peers, got %d", len(peers), len(counts))
+	}
+	bound := int(math.Ceil(1.25 * n / float64(len(peers))))
+	for peer, c := range counts {
+		if c > bound {
+			t.Fatalf("peer %v got %d requests, bound %d", peer, c, bound)
+		}
+	}
+	if peer, _ := pool.PickOwner("hot"); peer != owner {
+		t.Fatalf("PickOwner should ignore load")
+	}
+
+	for _, bg := range inflight {
+		bg.once.Do(bg.done)
+	}
+	if peer, _ := pool.PickPeer("hot"); peer.(*boundedGetter).PeerGetter != owner {
+		t.Fatalf("idle pool should pick the owner")
+	}
+}
+
+// 测试有界负载把 key 交给其他节点时，接收的节点直接加载，不再转发
+// 测试步骤
+//  1. 三个节点 a、owner、spill 各自有节点池和缓存组，服务端把请求交给本节点的缓存组
+//  2. 在 a 上占满 owner 的负载，找到交给 spill 的 key
+//  3. a 获取该 key，只在 spill 上加载一次，owner 不加载
+func TestBoundedLoadSpill(t *testing.T) {
+	type node struct {
+		pool  *HTTPPool
+		group *Group
+		loads atomic.Int64
+	}
+	nodes := make(map[string]*node)
+	var addrs []string
+	for i := 0; i < 3; i++ {
+		n := &node{}
+		name := fmt.Sprintf("spill-%d", i)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// 同一进程中缓存组按名字全局注册，把请求中的缓存组换成本节点的
+			key := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+			r.URL.Path = defaultBasePath + name + "/" + key
+			n.pool.ServeHTTP(w, r)
+		}))
+		defer srv.Close()
+		n.pool = NewHTTPPoolOpts(srv.URL, &HTTPPoolOptions{BoundedLoad: 0.25})
+		n.group = NewGroup(name, 2<<10, GetterFunc(func(key string) ([]byte, error) {
+			n.loads.Add(1)
+			return []byte(key + "@" + name), nil
+		}))
+		n.group.RegisterPeers(n.pool)
+		nodes[srv.URL] = n
+		addrs = append(addrs, srv.URL)
+	}
+	for _, n := range nodes {
+		n.pool.Set(addrs...)
+	}
+
+	// 在 a 上占用 owner 的负载，直到 PickPeer 把 key 交给 owner 和 a 以外的节点
+	a := nodes[addrs[0]]
+	var key, owner, spill string
+	var held []PeerGetter
+	for i := 0; key == "" && i < 100; i++ {
+		k := fmt.Sprintf("hot%d", i)
+		o := a.pool.Owner(k)
+		if o == addrs[0] {
+			continue
+		}
+		for j := 0; j < 10; j++ {
+			peer, ok := a.pool.PickPeer(k)
+			if !ok {
+				break
+			}
+			if addr := strings.TrimSuffix(peer.(peerAddresser).peerAddr(), defaultBasePath); addr != o {
+				peer.(peerReleaser).release()
+				key, owner, spill = k, o, addr
+				break
+			}
+			held = append(held, peer)
+		}
+		if key == "" {
+			for _, peer := range held {
+				peer.(peerReleaser).release()
+			}
+			held = nil
+		}
+	}
+	if key == "" {
+		t.Fatal("no key spilled to a third node")
+	}
+	defer func() {
+		for _, peer := range held {
+			peer.(peerReleaser).release()
+		}
+	}()
+
+	v, err := a.group.Get(key)
+	if err != nil || !strings.HasSuffix(v.String(), "@"+nodes[spill].group.Name()) {
+		t.Fatalf("Get(%s) = %q, %v, want it loaded on the spill target", key, v, err)
+	}
+	if n := nodes[spill].loads.Load(); n != 1 {
+		t.Fatalf("spill target loaded %d times, want 1", n)
+	}
+	if n := nodes[owner].loads.Load() + a.loads.Load(); n != 0 {
+		t.Fatalf("owner and requester loaded %d times, want 0", n)
+	}
+}
+
+// 测试启用有界负载时的批量获取
+// 测试步骤
+//  1. 三个远程节点记录批量请求的次数并返回 key@节点，启用有界负载后批量获取 30 个 key
+//  2. 每个节点最多收到一次批量请求，所有 key 都获取成功
+//  3. 请求结束后 PickPeer 占用的负载全部释放
+func TestGetMultiBoundedLoad(t *testing.T) {
+	pool := NewHTTPPoolOpts("http://self", &HTTPPoolOptions{BoundedLoad: 0.25})
+	var peers []string
+	batches := make(map[string]*atomic.Int64)
+	for i := 0; i < 3; i++ {
+		name := fmt.Sprintf("peer%d", i)
+		count := &atomic.Int64{}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var out []byte
+			if r.Method == http.MethodPost {
+				count.Add(1)
+				body, _ := io.ReadAll(r.Body)
+				req, res := &pb.BatchRequest{}, &pb.BatchResponse{}
+				proto.Unmarshal(body, req)
+				for _, key := range req.Keys {
+					res.Entries = append(res.Entries, &pb.BatchEntry{Key: key, Value: []byte(key + "@" + name)})
+				}
+				out, _ = proto.Marshal(res)
+			} else {
+				// 分给本节点的 key 在本地加载时仍可能因负载被交给远程节点
+				key := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+				out, _ = proto.Marshal(&pb.Response{Value: []byte(key + "@" + name)})
+			}
+			w.Write(out)
+		}))
+		defer srv.Close()
+		peers = append(peers, srv.URL)
+		batches[srv.URL] = count
+	}
+	pool.Set(append(peers, "http://self")...)
+	gee := NewGroup("boundedmulti", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key + "@local"), nil
+		}))
+	gee.RegisterPeers(pool)
+
+	keys := make([]string, 30)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+	}
+	values, err := gee.GetMulti(context.Background(), keys)
+	if err != nil || len(values) != len(keys) {
+		t.Fatalf("GetMulti = %d values, %v", len(values), err)
+	}
+	var total int64
+	for peer, count := range batches {
+		if n := count.Load(); n > 1 {
+			t.Fatalf("%s got %d batch requests, want at most one", peer, n)
+		}
+		total += count.Load()
+	}
+	if total == 0 {
+		t.Fatalf("no batch requests sent to peers")
+	}
+	ring := pool.peers.(*consistenthash.Map)
+	for _, peer := range peers {
+		if load := ring.Load(peer); load != 0 {
+			t.Fatalf("%s still has load %d after GetMulti", peer, load)
+		}
+	}
+}
+
+// 测试 ctx 的截止时间通过请求头转发给远程节点
+func TestHTTPDeadline(t *testing.T) {
+	deadlines := make(chan time.Duration, 1)
+	NewGroup("deadline", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			deadline, ok := ctx.Deadline()
+			if !ok {
+				return nil, fmt.Errorf("no deadline")
+			}
+			deadlines <- time.Until(deadline)
+			return []byte(key), nil
+		}))
+	srv := httptest.NewServer(NewHTTPPool(""))
+	defer srv.Close()
+
+	peer := NewHTTPPool("").newGetter(srv.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	res := &pb.Response{}
+	if err := peer.Get(ctx, &pb.Request{Group: "deadline", Key: "Tom"}, res); err != nil || string(res.Value) != "Tom" {
+		t.Fatalf("Get = %q, %v", res.Value, err)
+	}
+	if d := <-deadlines; d <= 0 || d > time.Second {
+		t.Fatalf("peer saw remaining time %v, want within 1s", d)
+	}
+}
+
+// 测试熔断器的状态转换
+func TestBreaker(t *testing.T) {
+	b := newBreaker(2, 20*time.Millisecond)
+	b.failure()
+	if !b.allow() {
+		t.Fatal("breaker should stay closed below the threshold")
+	}
+	b.failure()
+	if b.ready() || b.allow() {
+		t.Fatal("breaker should open after 2 failures")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("breaker should let a probe through after the cooldown")
+	}
+	if b.allow() {
+		t.Fatal("only one probe is allowed while half open")
+	}
+	b.failure()
+	if b.allow() {
+		t.Fatal("failed probe should reopen the breaker")
+	}
+	time.Sleep(30 * time.Millisecond)
+	b.allow()
+	b.success()
+	if !b.allow() || !b.allow() {
+		t.Fatal("successful probe should close the breaker")
+	}
+}
+
+// 返回前 fails 个请求都以 code 失败的节点，hits 记录收到的请求数
+func flakyPeer(t *testing.T, fails int32, code int, hits *atomic.Int32) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) <= fails {
+			http.Error(w, "flaky", code)
+			return
+		}
+		body, _ := proto.Marshal(&pb.Response{Value: []byte("ok")})
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// 测试网关类错误会重试，节点正常响应的错误不重试
+func TestPeerRetry(t *testing.T) {
+	var hits atomic.Int32
+	srv := flakyPeer(t, 2, http.StatusServiceUnavailable, &hits)
+	peer := NewHTTPPoolOpts("", &HTTPPoolOptions{RetryBackoff: time.Millisecond}).newGetter(srv.URL)
+	res := &pb.Response{}
+	if err := peer.Get(context.Background(), &pb.Request{Group: "g", Key: "k"}, res); err != nil || string(res.Value) != "ok" {
+		t.Fatalf("Get = %q, %v", res.Value, err)
+	}
+	if n := hits.Load(); n != 3 {
+		t.Fatalf("peer got %d requests, want 3", n)
+	}
+
+	hits.Store(0)
+	srv = flakyPeer(t, 1, http.StatusNotFound, &hits)
+	peer = NewHTTPPool("").newGetter(srv.URL)
+	if err := peer.Get(context.Background(), &pb.Request{Group: "g", Key: "k"}, &pb.Response{}); err == nil || hits.Load() != 1 {
+		t.Fatalf("404 should fail without retry, got %v after %d requests", err, hits.Load())
+	}
+}
+
+// 以函数实现 http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// 测试请求成功后调用方才取消时，试探请求仍算作成功并关闭熔断器
+func TestBreakerSuccessAfterCancel(t *testing.T) {
+	var hits atomic.Int32
+	srv := flakyPeer(t, 0, http.StatusServiceUnavailable, &hits)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// 读完响应后取消 ctx，请求本身已经成功
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		res, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		res.Body = io.NopCloser(bytes.NewReader(body))
+		cancel()
+		return res, err
+	})}
+	peer := NewHTTPPoolOpts("", &HTTPPoolOptions{
+		Client:           client,
+		BreakerThreshold: 1,
+		BreakerCooldown:  time.Millisecond,
+	}).newGetter(srv.URL)
+	peer.breaker.failure()
+	time.Sleep(2 * time.Millisecond)
+
+	if err := peer.Get(ctx, &pb.Request{Group: "g", Key: "k"}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	if !peer.breaker.allow() || !peer.breaker.allow() {
+		t.Fatal("successful probe should close the breaker even if ctx is canceled afterwards")
+	}
+}
+
+// 测试熔断器打开后 Group.load 直接在本地加载
+// 测试步骤
+//  1. 远程节点一直返回 503，连续失败 2 次后熔断器打开
+//  2. 之后的请求不再发往远程节点，直接在本地加载
+//  3. 节点恢复且冷却期过后，试探请求成功，重新从远程节点获取
+func TestPeerBreaker(t *testing.T) {
+	var hits atomic.Int32
+	srv := flakyPeer(t, 2, http.StatusServiceUnavailable, &hits)
+	pool := NewHTTPPoolOpts("", &HTTPPoolOptions{
+		Retries:          -1,
+		BreakerThreshold: 2,
+		BreakerCooldown:  50 * time.Millisecond,
+	})
+	pool.Set(srv.URL)
+	gee := NewGroup("breaker", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key + "@local"), nil
+		}), WithHotCache(-1))
+	gee.RegisterPeers(pool)
+
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if v, err := gee.Get(key); err != nil || v.String() != key+"@local" {
+			t.Fatalf("Get(%s) = %q, %v", key, v, err)
+		}
+	}
+	if s := gee.Stats(); hits.Load() != 2 || s.PeerErrors != 2 || s.LocalLoads != 5 {
+		t.Fatalf("peer hits %d, peer errors %d, local loads %d", hits.Load(), s.PeerErrors, s.LocalLoads)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if v, err := gee.Get("key5"); err != nil || v.String() != "ok" {
+		t.Fatalf("Get after cooldown = %q, %v; want value from peer", v, err)
+	}
+	if s := gee.Stats(); s.PeerLoads != 1 {
+		t.Fatalf("peer loads %d, want 1", s.PeerLoads)
+	}
+}
+
+// 测试不存在的 key 以 NOT_FOUND 状态返回给请求方，而不是 500 错误
+func TestHTTPNotFound(t *testing.T) {
+	NewGroup("http-notfound", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+		}))
+	srv := httptest.NewServer(NewHTTPPool(""))
+	defer srv.Close()
+
+	peer := NewHTTPPool("").newGetter(srv.URL)
+	res := &pb.Response{}
+	if err := peer.Get(context.Background(), &pb.Request{Group: "http-notfound", Key: "Tom"}, res); err != nil || res.Status != pb.Status_NOT_FOUND {
+		t.Fatalf("Get = %v, %v, want NOT_FOUND", res.Status, err)
+	}
+	batch := &pb.BatchResponse{}
+	if err := peer.GetMulti(context.Background(), &pb.BatchRequest{Group: "http-notfound", Keys: []string{"Tom"}}, batch); err != nil ||
+		len(batch.Entries) != 1 || batch.Entries[0].Status != pb.Status_NOT_FOUND {
+		t.Fatalf("GetMulti = %v, %v, want NOT_FOUND", batch.Entries, err)
+	}
+}
+
+// 测试批量请求的请求体超过上限时返回 413
+func TestHTTPBatchTooLarge(t *testing.T) {
+	NewGroup("http-batch-large", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	srv := httptest.NewServer(NewHTTPPool(""))
+	defer srv.Close()
+
+	body := bytes.NewReader(make([]byte, maxBatchRequestBytes+1))
+	res, err := http.Post(srv.URL+defaultBasePath+"http-batch-large/"+batchKey, "application/octet-stream", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", res.StatusCode)
+	}
+}
+
+// 测试管理接口
+// 测试步骤
+//  1. 列出缓存组，查看缓存值时不触发加载
+//  2. 删除单个缓存值，缩小容量后超出的缓存项被淘汰，清空缓存组
+//  3. 配置了密钥时未签名的管理请求被拒绝
+func TestAdmin(t *testing.T) {
+	loads := 0
+	gee := NewGroup("admin", 1<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(key + "-value"), nil
+		}))
+	for i := 0; i < 10; i++ {
+		gee.Get(fmt.Sprintf("key%d", i))
+	}
+	pool := NewHTTPPool("")
+	admin := defaultBasePath + defaultAdminPath
+	serve := func(method, path string, out interface{}) int {
+		w := httptest.NewRecorder()
+		pool.ServeHTTP(w, httptest.NewRequest(method, admin+path, nil))
+		if out != nil && w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+				t.Fatalf("%s %s: %v", method, path, err)
+			}
+		}
+		return w.Code
+	}
+
+	var infos []GroupInfo
+	if code := serve(http.MethodGet, "/groups", &infos); code != http.StatusOK {
+		t.Fatalf("list groups got %d", code)
+	}
+	found := false
+	for _, info := range infos {
+		if info.Name == "admin" {
+			found = info.Items == 10 && info.CacheBytes == 1<<10
+		}
+	}
+	if !found {
+		t.Fatalf("admin group missing or wrong size in %+v", infos)
+	}
+
+	var key KeyInfo
+	before := gee.CacheStats(MainCache)
+	if code := serve(http.MethodGet, "/groups/admin/keys/key1", &key); code != http.StatusOK || string(key.Value) != "key1-value" || key.Cache != "main" {
+		t.Fatalf("peek key1 = %d, %+v", code, key)
+	}
+	if after := gee.CacheStats(MainCache); after.Gets != before.Gets || after.Hits != before.Hits {
+		t.Fatalf("peek should not count as a cache access: %+v -> %+v", before, after)
+	}
+	if code := serve(http.MethodGet, "/groups/admin/keys/missing", nil); code != http.StatusNotFound || loads != 10 {
+		t.Fatalf("peek missing = %d with %d loads, want 404 without loading", code, loads)
+	}
+	if code := serve(http.MethodDelete, "/groups/admin/keys/key1", nil); code != http.StatusNoContent {
+		t.Fatalf("evict key1 got %d", code)
+	}
+	if code := serve(http.MethodGet, "/groups/admin/keys/key1", nil); code != http.StatusNotFound {
+		t.Fatalf("evicted key1 should be gone, got %d", code)
+	}
+
+	var info GroupInfo
+	if code := serve(http.MethodPut, "/groups/admin?bytes=40", &info); code != http.StatusOK || info.CacheBytes != 40 || info.Bytes > 40 || info.Items != 2 {
+		t.Fatalf("resize = %d, %+v", code, info)
+	}
+	if code := serve(http.MethodPut, "/groups/admin?bytes=-1", nil); code != http.StatusBadRequest {
+		t.Fatalf("negative size got %d, want 400", code)
+	}
+	if code := serve(http.MethodDelete, "/groups/admin/keys", &info); code != http.StatusOK || info.Items != 0 {
+		t.Fatalf("clear = %d, %+v", code, info)
+	}
+	if code := serve(http.MethodGet, "/groups/nope", nil); code != http.StatusNotFound {
+		t.Fatalf("unknown group got %d, want 404", code)
+	}
+
+	pool = NewHTTPPoolOpts("", &HTTPPoolOptions{Secret: []byte("s3cret")})
+	if code := serve(http.MethodGet, "/groups", nil); code != http.StatusUnauthorized {
+		t.Fatalf("unsigned admin request got %d, want 401", code)
+	}
+}
+
+// 测试大缓存值的分块传输和长度限制
+// 测试步骤
+//  1. 超过 StreamThreshold 的缓存值分块传输，内容与原值相同
+//  2. 接收方的 MaxValueBytes 小于缓存值时返回 ErrValueTooLarge
+//  3. 发送方的 MaxValueBytes 小于缓存值时返回 413，请求方得到 ErrValueTooLarge
+func TestHTTPStream(t *testing.T) {
+	big := bytes.Repeat([]byte("0123456789abcdef"), 3<<16) // 3MB
+	NewGroup("stream", 0, GetterFunc(
+		func(key string) ([]byte, error) {
+			return big, nil
+		}))
+	var contentType atomic.Value
+	pool := NewHTTPPool("")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pool.ServeHTTP(w, r)
+		contentType.Store(w.Header().Get("Content-Type"))
+	}))
+	defer srv.Close()
+
+	res := &pb.Response{}
+	if err := NewHTTPPool("").newGetter(srv.URL).Get(context.Background(), &pb.Request{Group: "stream", Key: "big"}, res); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(res.Value, big) {
+		t.Fatalf("streamed value differs, got %d bytes", len(res.Value))
+	}
+	if ct := contentType.Load(); ct != streamContentType {
+		t.Fatalf("Content-Type = %v, want %s", ct, streamContentType)
+	}
+
+	small := NewHTTPPoolOpts("", &HTTPPoolOptions{MaxValueBytes: 1 << 20}).newGetter(srv.URL)
+	if err := small.Get(context.Background(), &pb.Request{Group: "stream", Key: "big"}, &pb.Response{}); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("receiver limit: expect ErrValueTooLarge, got %v", err)
+	}
+
+	limited := httptest.NewServer(NewHTTPPoolOpts("", &HTTPPoolOptions{MaxValueBytes: 1 << 20}))
+	defer limited.Close()
+	if err := NewHTTPPool("").newGetter(limited.URL).Get(context.Background(), &pb.Request{Group: "stream", Key: "big"}, &pb.Response{}); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("sender limit: expect ErrValueTooLarge, got %v", err)
+	}
+}
+
+// 测试分块传输的数据损坏、截断和长度限制
+func TestReadStream(t *testing.T) {
+	value := bytes.Repeat([]byte{'x'}, streamChunkSize*2+100)
+	var buf bytes.Buffer
+	if err := writeStream(&buf, &pb.Response{Expire: 42}, value); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	res := &pb.Response{}
+	if err := readStream(bytes.NewReader(data), res, 0); err != nil || res.Expire != 42 || !bytes.Equal(res.Value, value) {
+		t.Fatalf("readStream = %d bytes, expire %d, %v", len(res.Value), res.Expire, err)
+	}
+
+	corrupt := bytes.Clone(data)
+	corrupt[len(corrupt)/2] ^= 0xff
+	if err := readStream(bytes.NewReader(corrupt), &pb.Response{}, 0); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("corrupted chunk: expect ErrChecksum, got %v", err)
+	}
+	if err := readStream(bytes.NewReader(data[:len(data)-10]), &pb.Response{}, 0); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("truncated stream: expect io.ErrUnexpectedEOF, got %v", err)
+	}
+	if err := readStream(bytes.NewReader(data), &pb.Response{}, streamChunkSize); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("limit: expect ErrValueTooLarge, got %v", err)
+	}
+
+	// 没有长度限制时，声明超大总长度的响应只会因数据不足而失败，不会按声明的长度分配内存
+	var huge []byte
+	huge = binary.AppendUvarint(huge, 0)
+	huge = binary.AppendUvarint(huge, math.MaxUint64)
+	huge = binary.AppendUvarint(huge, 3)
+	huge = append(huge, "abc"...)
+	huge = binary.BigEndian.AppendUint32(huge, crc32.ChecksumIEEE([]byte("abc")))
+	if err := readStream(bytes.NewReader(huge), &pb.Response{}, 0); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("huge declared size: expect io.ErrUnexpectedEOF, got %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package lfu
+
+import (
+	"container/heap"
+	"geecache/lru"
+	"sort"
+	"time"
+)
+
+// Cache LFU 缓存，淘汰访问次数最少的缓存项，
+// 访问次数相同时淘汰最久未被访问的缓存项
+type Cache struct {
+	maxBytes int64
+	nbytes   int64
+	// 按访问次数组织的小根堆，堆顶是下一个被淘汰的缓存项
+	queue entryHeap
+	cache map[string]*entry
+	// 逻辑时钟，每次访问递增，用于次数相同时比较新旧
+	tick uint64
+	// 与 lru.Cache 相同的淘汰回调
+	OnEvicted func(key string, value lru.Value, reason lru.EvictReason)
+}
+
+type entry struct {
+	key    string
+	value  lru.Value
+	expire time.Time
+	// 访问次数
+	freq int
+	// 最近一次访问的逻辑时间
+	tick uint64
+	// 在堆中的下标
+	index int
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
+}
+
+func New(maxBytes int64, onEvicted func(string, lru.Value, lru.EvictReason)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		cache:     make(map[string]*entry),
+		OnEvicted: onEvicted,
+	}
+}
+
+// 更新缓存项的访问次数，并调整其在堆中的位置
+func (c *Cache) touch(e *entry) {
+	c.tick++
+	e.freq++
+	e.tick = c.tick
+	heap.Fix(&c.queue, e.index)
+}
+
+func (c *Cache) Get(key string) (value lru.Value, ok bool) {
+	if e, ok := c.cache[key]; ok {
+		if e.expired(time.Now()) {
+			c.removeEntry(e, lru.EvictExpired)
+			return nil, false
+		}
+		c.touch(e)
+		return e.value, true
+	}
+	return
+}
+
+// Peek 返回缓存值但不增加访问次数，已过期的缓存项视为不存在但不会被删除
+func (c *Cache) Peek(key string) (value lru.Value, ok bool) {
+	if e, ok := c.cache[key]; ok && !e.expired(time.Now()) {
+		return e.value, true
+	}
+	return
+}
+
+func (c *Cache) Add(key string, value lru.Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire 添加缓存项并指定过期时间，expire 为零值表示永不过期
+func (c *Cache) AddWithExpire(key string, value lru.Value, expire time.Time) {
+	if e, ok := c.cache[key]; ok {
+		c.nbytes += int64(value.Len()) - int64(e.value.Len())
+		e.value = value
+		e.expire = expire
+		c.touch(e)
+	} else {
+		c.tick++
+		e := &entry{key: key, value: value, expire: expire, freq: 1, tick: c.tick}
+		heap.Push(&c.queue, e)
+		c.cache[key] = e
+		c.nbytes += int64(len(key) + value.Len())
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+	}
+}
+
+// RemoveOldest 淘汰访问次数最少的缓存项
+func (c *Cache) RemoveOldest() {
+	if c.queue.Len() > 0 {
+		c.removeEntry(c.queue[0], lru.EvictCapacity)
+	}
+}
+
+// SetMaxBytes 修改最大字节数，超出新上限时通过 RemoveOldest 淘汰缓存项
+func (c *Cache) SetMaxBytes(maxBytes int64) {
+	c.maxBytes = maxBytes
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+	}
+}
+
+// Remove 主动删除缓存项
+func (c *Cache) Remove(key string) {
+	if e, ok := c.cache[key]; ok {
+		c.removeEntry(e, lru.EvictRemoved)
+	}
+}
+
+// RemoveExpired 删除所有已过期的缓存项，返回删除的数量
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	var expired []*entry
+	for _, e := range c.cache {
+		if e.expired(now) {
+			expired = append(expired, e)
+		}
+	}
+	for _, e := range expired {
+		c.removeEntry(e, lru.EvictExpired)
+	}
+	return len(expired)
+}
+
+func (c *Cache) removeEntry(e *entry, reason lru.EvictReason) {
+	heap.Remove(&c.queue, e.index)
+	delete(c.cache, e.key)
+	c.nbytes -= int64(len(e.key)) + int64(e.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value, reason)
+	}
+}
+
+// Range 按淘汰顺序(访问次数从少到多，次数相同时从旧到新)遍历缓存项，
+// fn 返回 false 时停止遍历
+func (c *Cache) Range(fn func(key string, value lru.Value, expire time.Time) bool) {
+	entries := make([]*entry, len(c.queue))
+	copy(entries, c.queue)
+	sort.Slice(entries, func(i, j int) bool { return c.queue.Less(entries[i].index, entries[j].index) })
+	for _, e := range entries {
+		if !fn(e.key, e.value, e.expire) {
+			return
+		}
+	}
+}
+
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// Bytes 返回当前已使用的字节数
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
+// entryHeap 实现 heap.Interface，按访问次数、访问时间排序
+type entryHeap []*entry
+
+func (h entryHeap) Len() int { return len(h) }
+
+func (h entryHeap) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].tick < h[j].tick
+}
+
+func (h entryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *entryHeap) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *entryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
@@ -0,0 +1,62 @@
+package lfu
+
+import (
+	"geecache/lru"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	lfu := New(int64(10), nil)
+	lfu.Add("key1", String("1234"))
+	if v, ok := lfu.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := lfu.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestRemoveOldest(t *testing.T) {
+	// 测试逻辑
+	// 测试步骤：
+	// 1. 设置缓存容量只能缓存两个缓存项，添加k1、k2
+	// 2. 多次访问k1，k2只在添加时访问一次
+	// 3. 添加k3，访问次数最少的k2被淘汰，k1保留
+	keys := make([]string, 0)
+	lfu := New(int64(8), func(key string, value lru.Value, reason lru.EvictReason) {
+		keys = append(keys, key)
+	})
+	lfu.Add("k1", String("v1"))
+	lfu.Add("k2", String("v2"))
+	lfu.Get("k1")
+	lfu.Get("k1")
+	lfu.Add("k3", String("v3"))
+
+	if _, ok := lfu.Get("k1"); !ok || lfu.Len() != 2 {
+		t.Fatalf("frequently used k1 should be kept")
+	}
+	if !reflect.DeepEqual(keys, []string{"k2"}) {
+		t.Fatalf("expect evicted keys %v, got %v", []string{"k2"}, keys)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.AddWithExpire("k1", String("v1"), time.Now().Add(-time.Second))
+	lfu.Add("k2", String("v2"))
+	if _, ok := lfu.Get("k1"); ok {
+		t.Fatalf("expired k1 should miss")
+	}
+	lfu.AddWithExpire("k3", String("v3"), time.Now().Add(-time.Second))
+	if n := lfu.RemoveExpired(); n != 1 || lfu.Len() != 1 || lfu.Bytes() != 4 {
+		t.Fatalf("RemoveExpired failed, removed %d, left %d", n, lfu.Len())
+	}
+}
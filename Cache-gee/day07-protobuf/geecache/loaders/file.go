@@ -0,0 +1,101 @@
+package loaders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geecache"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// File 从目录中读取与 key 同名的文件作为缓存值，key 中可以用 / 分隔子目录，
+// 但不能包含 ..，也不能以 / 开头
+type File struct {
+	FS fs.FS
+	// 附加在 key 后的扩展名，例如 ".json"
+	Ext string
+	// 每次读取的超时时间，默认是 3s，小于 0 表示不限制
+	Timeout time.Duration
+}
+
+// NewDir 创建读取本地目录 dir 中的文件的数据源
+func NewDir(dir string) *File {
+	return &File{FS: os.DirFS(dir)}
+}
+
+var (
+	_ geecache.ContextGetter = (*File)(nil)
+	_ geecache.ReaderGetter  = (*File)(nil)
+)
+
+func (f *File) Get(key string) ([]byte, error) {
+	return f.GetContext(context.Background(), key)
+}
+
+func (f *File) GetContext(ctx context.Context, key string) ([]byte, error) {
+	r, _, err := f.GetReader(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, classify(err))
+	}
+	return b, nil
+}
+
+// GetReader 打开 key 对应的文件，缓存组直接从文件读入缓存，超时时间包括读取的时间
+func (f *File) GetReader(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	name := key + f.Ext
+	if !fs.ValidPath(name) || name == "." {
+		return nil, 0, fmt.Errorf("%s: %w: not a relative slash-separated path", key, ErrBadKey)
+	}
+	ctx, cancel := withTimeout(ctx, f.Timeout)
+	file, err := f.FS.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		cancel()
+		return nil, 0, fmt.Errorf("%s: %w", key, geecache.ErrNotFound)
+	}
+	if err != nil {
+		cancel()
+		return nil, 0, fmt.Errorf("%s: %w", key, classify(err))
+	}
+	fi, err := file.Stat()
+	if err == nil && fi.IsDir() {
+		err = fmt.Errorf("%w: is a directory", ErrBadKey)
+	}
+	if err != nil {
+		file.Close()
+		cancel()
+		return nil, 0, fmt.Errorf("%s: %w", key, err)
+	}
+	size := fi.Size()
+	if !fi.Mode().IsRegular() {
+		// 管道等特殊文件的长度不可信
+		size = -1
+	}
+	return &ctxReader{ctx: ctx, cancel: cancel, r: file}, size, nil
+}
+
+// 每次读取前检查 ctx，超时后不再继续读取
+type ctxReader struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	r      io.ReadCloser
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, classify(err)
+	}
+	return c.r.Read(p)
+}
+
+func (c *ctxReader) Close() error {
+	c.cancel()
+	return c.r.Close()
+}
@@ -0,0 +1,55 @@
+package loaders
+
+import (
+	"context"
+	"errors"
+	"geecache"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// 测试从目录读取文件
+// 测试步骤
+//  1. 读取本地目录和子目录中的文件，缓存组直接从 Reader 读入
+//  2. 文件不存在时返回 ErrNotFound，目录和越过根目录的 key 返回 ErrBadKey
+//  3. 超过截止时间后读取失败
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "users"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "users", "Tom.json"), []byte(`{"score":630}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f := NewDir(dir)
+	f.Ext = ".json"
+	if v, err := f.Get("users/Tom"); err != nil || string(v) != `{"score":630}` {
+		t.Fatalf("Get(users/Tom) = %q, %v", v, err)
+	}
+	g := geecache.NewGroup("loaders-file", 2<<10, f)
+	if v, err := g.Get("users/Tom"); err != nil || v.String() != `{"score":630}` {
+		t.Fatalf("group Get(users/Tom) = %q, %v", v, err)
+	}
+
+	if _, err := f.Get("users/Sam"); !errors.Is(err, geecache.ErrNotFound) {
+		t.Fatalf("missing file: expect ErrNotFound, got %v", err)
+	}
+	for _, key := range []string{"../secret", "/etc/passwd"} {
+		if _, err := f.Get(key); !errors.Is(err, ErrBadKey) {
+			t.Fatalf("Get(%q): expect ErrBadKey, got %v", key, err)
+		}
+	}
+	dirs := &File{FS: fstest.MapFS{"users/Tom": {Data: []byte("630")}}}
+	if _, err := dirs.Get("users"); !errors.Is(err, ErrBadKey) {
+		t.Fatalf("directory: expect ErrBadKey, got %v", err)
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if _, err := f.GetContext(ctx, "users/Tom"); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expired deadline: expect ErrTimeout, got %v", err)
+	}
+}
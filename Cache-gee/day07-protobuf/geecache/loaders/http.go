@@ -0,0 +1,155 @@
+package loaders
+
+import (
+	"context"
+	"fmt"
+	"geecache"
+	"geecache/lru"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 默认最多保留 16MB 带有 ETag 的响应
+const defaultETagCacheBytes = 16 << 20
+
+// HTTP 从上游 HTTP 服务加载缓存值，例如
+//
+//	&loaders.HTTP{URL: "http://users.internal/v1/users/{key}"}
+//
+// 上游返回 ETag 时，最近的响应会被保留，再次加载同一个 key 时带上 If-None-Match，
+// 上游返回 304 时直接使用保留的响应。404 和 410 视为 key 不存在，429 和 5xx 视为暂时不可用
+type HTTP struct {
+	// 上游地址，{key} 替换为转义后的 key，没有 {key} 时 key 附加在末尾
+	URL string
+	// 默认使用 http.DefaultClient
+	Client *http.Client
+	// 附加在每个请求上的请求头，例如 Authorization
+	Header http.Header
+	// 每次请求的超时时间，默认是 3s，小于 0 表示不限制
+	Timeout time.Duration
+	// 响应体的最大长度，0 表示不限制
+	MaxBytes int64
+	// 保留带有 ETag 的响应最多占用的字节数，默认是 16MB，小于 0 表示不使用 ETag
+	ETagCacheBytes int64
+
+	mu    sync.Mutex
+	etags *lru.Cache
+}
+
+// 保留的带有 ETag 的响应
+type etagEntry struct {
+	etag  string
+	value []byte
+}
+
+func (e *etagEntry) Len() int {
+	return len(e.etag) + len(e.value)
+}
+
+var _ geecache.ContextGetter = (*HTTP)(nil)
+
+func (h *HTTP) Get(key string) ([]byte, error) {
+	return h.GetContext(context.Background(), key)
+}
+
+func (h *HTTP) GetContext(ctx context.Context, key string) ([]byte, error) {
+	ctx, cancel := withTimeout(ctx, h.Timeout)
+	defer cancel()
+	u := h.URL
+	if strings.Contains(u, "{key}") {
+		u = strings.ReplaceAll(u, "{key}", url.PathEscape(key))
+	} else {
+		u += url.PathEscape(key)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %v", key, ErrBadKey, err)
+	}
+	for k, v := range h.Header {
+		req.Header[k] = v
+	}
+	cached := h.lookup(key)
+	if cached != nil {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, classify(err))
+	}
+	defer res.Body.Close()
+
+	switch code := res.StatusCode; {
+	case code == http.StatusNotModified && cached != nil:
+		return cached.value, nil
+	case code == http.StatusOK:
+	case code == http.StatusNotFound, code == http.StatusGone:
+		return nil, fmt.Errorf("%s: %w", key, geecache.ErrNotFound)
+	case code == http.StatusTooManyRequests, code >= 500:
+		return nil, fmt.Errorf("%s: %w: upstream returned %v", key, ErrUnavailable, res.Status)
+	case code >= 400:
+		return nil, fmt.Errorf("%s: %w: upstream returned %v", key, ErrBadKey, res.Status)
+	default:
+		return nil, fmt.Errorf("%s: unexpected upstream status %v", key, res.Status)
+	}
+
+	body := io.Reader(res.Body)
+	if h.MaxBytes > 0 {
+		if res.ContentLength > h.MaxBytes {
+			return nil, fmt.Errorf("%s: %w: %d bytes", key, geecache.ErrValueTooLarge, res.ContentLength)
+		}
+		body = io.LimitReader(res.Body, h.MaxBytes+1)
+	}
+	value, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, classify(err))
+	}
+	if h.MaxBytes > 0 && int64(len(value)) > h.MaxBytes {
+		return nil, fmt.Errorf("%s: %w: more than %d bytes", key, geecache.ErrValueTooLarge, h.MaxBytes)
+	}
+	h.remember(key, res.Header.Get("ETag"), value)
+	return value, nil
+}
+
+// 查找 key 上次的响应，没有 ETag 时返回 nil
+func (h *HTTP) lookup(key string) *etagEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.etags == nil {
+		return nil
+	}
+	if v, ok := h.etags.Get(key); ok {
+		return v.(*etagEntry)
+	}
+	return nil
+}
+
+// 保留带有 ETag 的响应，响应没有 ETag 时删除旧的记录
+func (h *HTTP) remember(key, etag string, value []byte) {
+	if h.ETagCacheBytes < 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if etag == "" {
+		if h.etags != nil {
+			h.etags.Remove(key)
+		}
+		return
+	}
+	if h.etags == nil {
+		maxBytes := h.ETagCacheBytes
+		if maxBytes == 0 {
+			maxBytes = defaultETagCacheBytes
+		}
+		h.etags = lru.New(maxBytes, nil)
+	}
+	h.etags.Add(key, &etagEntry{etag: etag, value: value})
+}
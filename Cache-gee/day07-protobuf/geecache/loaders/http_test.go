@@ -0,0 +1,72 @@
+package loaders
+
+import (
+	"errors"
+	"geecache"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 测试从上游 HTTP 服务加载
+// 测试步骤
+//  1. 第一次加载得到完整响应，再次加载时上游返回 304，使用保留的响应
+//  2. 404 返回 ErrNotFound，503 返回 ErrUnavailable，400 返回 ErrBadKey
+//  3. 上游超过 Timeout 没有响应时返回 ErrTimeout
+func TestHTTP(t *testing.T) {
+	var full, notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0ken" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/scores/Tom":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				notModified.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			full.Add(1)
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte("630"))
+		case "/scores/busy":
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		case "/scores/bad":
+			http.Error(w, "bad", http.StatusBadRequest)
+		case "/scores/slow":
+			time.Sleep(100 * time.Millisecond)
+			w.Write([]byte("slow"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	h := &HTTP{
+		URL:     srv.URL + "/scores/{key}",
+		Header:  http.Header{"Authorization": {"Bearer t0ken"}},
+		Timeout: 20 * time.Millisecond,
+	}
+	for i := 0; i < 2; i++ {
+		if v, err := h.Get("Tom"); err != nil || string(v) != "630" {
+			t.Fatalf("Get(Tom) #%d = %q, %v", i, v, err)
+		}
+	}
+	if full.Load() != 1 || notModified.Load() != 1 {
+		t.Fatalf("expect 1 full response and 1 revalidation, got %d and %d", full.Load(), notModified.Load())
+	}
+
+	for key, want := range map[string]error{
+		"Sam":  geecache.ErrNotFound,
+		"busy": ErrUnavailable,
+		"bad":  ErrBadKey,
+		"slow": ErrTimeout,
+	} {
+		if _, err := h.Get(key); !errors.Is(err, want) {
+			t.Fatalf("Get(%s): expect %v, got %v", key, want, err)
+		}
+	}
+}
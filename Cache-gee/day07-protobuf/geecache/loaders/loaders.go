@@ -0,0 +1,55 @@
+// Package loaders 提供常见数据源的 geecache.Getter 实现：database/sql 查询、本地目录中的文件
+// 和上游 HTTP 服务。所有数据源都支持 context 和超时，并把错误归为以下几类，
+// 可以用 errors.Is 判断：
+//
+//   - geecache.ErrNotFound：数据源中不存在该 key，缓存组会按 WithNegativeTTL 缓存这一结果
+//   - ErrTimeout：超过了数据源的超时时间或调用方的截止时间
+//   - ErrUnavailable：数据源暂时不可用，例如连接失败或上游返回 5xx，稍后重试可能成功
+//   - ErrBadKey：key 不合法，重试也不会成功
+package loaders
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+var (
+	// ErrTimeout 加载超时
+	ErrTimeout = errors.New("loaders: timeout")
+	// ErrUnavailable 数据源暂时不可用
+	ErrUnavailable = errors.New("loaders: source unavailable")
+	// ErrBadKey key 不合法
+	ErrBadKey = errors.New("loaders: bad key")
+)
+
+// 数据源的默认超时时间
+const defaultTimeout = 3 * time.Second
+
+// 按数据源的超时时间设置 ctx，timeout 为 0 时使用默认值，小于 0 表示不限制
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	if timeout < 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// 将超时和网络错误归类，其他错误原样返回
+func classify(err error) error {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	case errors.As(err, &netErr), errors.Is(err, driver.ErrBadConn):
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
@@ -0,0 +1,42 @@
+package loaders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"geecache"
+	"time"
+)
+
+// SQL 用一条查询语句从数据库加载缓存值，例如
+//
+//	&loaders.SQL{DB: db, Query: "SELECT value FROM scores WHERE name = ?"}
+//
+// 查询语句唯一的参数是 key，返回一行一列；没有结果时返回 geecache.ErrNotFound，值为 NULL 时缓存值为空
+type SQL struct {
+	DB    *sql.DB
+	Query string
+	// 每次查询的超时时间，默认是 3s，小于 0 表示不限制
+	Timeout time.Duration
+}
+
+var _ geecache.ContextGetter = (*SQL)(nil)
+
+func (s *SQL) Get(key string) ([]byte, error) {
+	return s.GetContext(context.Background(), key)
+}
+
+func (s *SQL) GetContext(ctx context.Context, key string) ([]byte, error) {
+	ctx, cancel := withTimeout(ctx, s.Timeout)
+	defer cancel()
+	var value []byte
+	err := s.DB.QueryRowContext(ctx, s.Query, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%s: %w", key, geecache.ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, classify(err))
+	}
+	return value, nil
+}
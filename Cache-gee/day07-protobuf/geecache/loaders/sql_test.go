@@ -0,0 +1,53 @@
+package loaders
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"geecache"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// 测试从 SQLite 内存数据库加载
+// 测试步骤
+//  1. 按 key 查询到的值作为缓存值
+//  2. 没有结果时返回 ErrNotFound
+//  3. 超过截止时间时返回 ErrTimeout
+func TestSQL(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// 每个连接是一个独立的内存数据库
+	db.SetMaxOpenConns(1)
+	for _, stmt := range []string{
+		"CREATE TABLE scores (name TEXT PRIMARY KEY, score TEXT)",
+		"INSERT INTO scores VALUES ('Tom', '630'), ('Jack', '589')",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &SQL{DB: db, Query: "SELECT score FROM scores WHERE name = ?"}
+
+	if v, err := s.Get("Tom"); err != nil || string(v) != "630" {
+		t.Fatalf("Get(Tom) = %q, %v", v, err)
+	}
+	if _, err := s.Get("Sam"); !errors.Is(err, geecache.ErrNotFound) {
+		t.Fatalf("Get(Sam): expect ErrNotFound, got %v", err)
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if _, err := s.GetContext(ctx, "Jack"); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expired deadline: expect ErrTimeout, got %v", err)
+	}
+
+	g := geecache.NewGroup("loaders-sql", 2<<10, s)
+	if v, err := g.Get("Jack"); err != nil || v.String() != "589" {
+		t.Fatalf("group Get(Jack) = %q, %v", v, err)
+	}
+}
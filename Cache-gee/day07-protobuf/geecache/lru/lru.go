@@ -2,6 +2,7 @@ package lru
 
 import (
 	"container/list"
+	"time"
 )
 
 type Cache struct {
@@ -14,19 +15,51 @@ type Cache struct {
 	//被用来作为缓存项被移除时的处理操作
 	//用户可以根据需要在该函数中实现自定义的处理逻辑，
 	//比如将被移除的缓存项记录到日志中、从数据库中删除等操作。
-	OnEvicted func(key string, value Value)
+	//reason 表示缓存项被移除的原因
+	OnEvicted func(key string, value Value, reason EvictReason)
+}
+
+// EvictReason 缓存项被移除的原因
+type EvictReason int
+
+const (
+	// EvictCapacity 缓存容量不足，淘汰最久未使用的缓存项
+	EvictCapacity EvictReason = iota
+	// EvictExpired 缓存项已过期
+	EvictExpired
+	// EvictRemoved 缓存项被主动删除
+	EvictRemoved
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictExpired:
+		return "expired"
+	case EvictRemoved:
+		return "removed"
+	}
+	return "unknown"
 }
 
 type entry struct {
 	key   string
 	value Value
+	// 过期时间，零值表示永不过期
+	expire time.Time
+}
+
+// 判断缓存项在 now 时刻是否已过期
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
 }
 
 type Value interface {
 	Len() int
 }
 
-func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
+func New(maxBytes int64, onEvicted func(string, Value, EvictReason)) *Cache {
 	return &Cache{
 		maxBytes: maxBytes,
 		//返回一个空的双向链表
@@ -38,39 +71,86 @@ func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
 
 func (c *Cache) Get(key string) (value Value, ok bool) {
 	if ele, ok := c.cache[key]; ok {
-		c.ll.MoveToFront(ele)
 		//断言用于将一个接口类型的值转换为特定类型
 		//将ele.Value断言为*entry类型，并将其赋值给kv变量
 		// 这意味着ele.Value必须是*entry类型，
 		// 否则断言将会失败并引发panic。
 		kv := ele.Value.(*entry)
+		// 惰性过期：访问时发现已过期则直接删除
+		if kv.expired(time.Now()) {
+			c.removeElement(ele, EvictExpired)
+			return nil, false
+		}
+		c.ll.MoveToFront(ele)
 		return kv.value, true
 	}
 	return
 }
 
+// Peek 返回缓存值但不调整淘汰顺序，已过期的缓存项视为不存在但不会被删除
+func (c *Cache) Peek(key string) (value Value, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		if kv := ele.Value.(*entry); !kv.expired(time.Now()) {
+			return kv.value, true
+		}
+	}
+	return
+}
+
 func (c *Cache) RemoveOldest() {
 	ele := c.ll.Back()
 	if ele != nil {
-		c.ll.Remove(ele)
-		kv := ele.Value.(*entry)
-		delete(c.cache, kv.key)
-		//更新当前缓存
-		c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
+		c.removeElement(ele, EvictCapacity)
+	}
+}
+
+// Remove 主动删除缓存项
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele, EvictRemoved)
+	}
+}
+
+// RemoveExpired 删除所有已过期的缓存项，返回删除的数量
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	n := 0
+	for ele := c.ll.Back(); ele != nil; {
+		prev := ele.Prev()
+		if ele.Value.(*entry).expired(now) {
+			c.removeElement(ele, EvictExpired)
+			n++
 		}
+		ele = prev
+	}
+	return n
+}
+
+func (c *Cache) removeElement(ele *list.Element, reason EvictReason) {
+	c.ll.Remove(ele)
+	kv := ele.Value.(*entry)
+	delete(c.cache, kv.key)
+	//更新当前缓存
+	c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value, reason)
 	}
 }
 
 func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire 添加缓存项并指定过期时间，expire 为零值表示永不过期
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
 	if ele, ok := c.cache[key]; ok {
 		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
 		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
 		kv.value = value
+		kv.expire = expire
 	} else {
-		ele := c.ll.PushFront(&entry{key, value})
+		ele := c.ll.PushFront(&entry{key, value, expire})
 		c.cache[key] = ele
 		c.nbytes += int64(len(key) + value.Len())
 	}
@@ -79,6 +159,30 @@ func (c *Cache) Add(key string, value Value) {
 	}
 }
 
+// Range 从最久未使用到最近使用依次遍历缓存项，fn 返回 false 时停止遍历。
+// 按遍历顺序重新添加可以恢复原来的使用顺序
+func (c *Cache) Range(fn func(key string, value Value, expire time.Time) bool) {
+	for ele := c.ll.Back(); ele != nil; ele = ele.Prev() {
+		kv := ele.Value.(*entry)
+		if !fn(kv.key, kv.value, kv.expire) {
+			return
+		}
+	}
+}
+
+// SetMaxBytes 修改最大字节数，超出新上限时通过 RemoveOldest 淘汰缓存项
+func (c *Cache) SetMaxBytes(maxBytes int64) {
+	c.maxBytes = maxBytes
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+	}
+}
+
 func (c *Cache) Len() int {
 	return c.ll.Len()
 }
+
+// Bytes 返回当前已使用的字节数
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
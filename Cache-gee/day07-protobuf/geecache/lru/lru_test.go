@@ -3,6 +3,7 @@ package lru
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 type String string
@@ -26,7 +27,7 @@ func TestGet(t *testing.T) {
 	if v, ok := lru.Get("key1"); !ok || string(v.(String)) != "1234" {
 		t.Fatalf("cache hit key1=1234 failed")
 	}
-	if _, ok := lru.Get("key2"); !ok {
+	if _, ok := lru.Get("key2"); ok {
 		t.Fatalf("cache miss key2 failed")
 	}
 }
@@ -68,7 +69,7 @@ func TestOnEvicted(t *testing.T) {
 	// 10. 比较keys和expect，若不相等，测试失败，返回语句
 	// 若测试通过，不返回值
 	keys := make([]string, 0)
-	callback := func(key string, value Value) {
+	callback := func(key string, value Value, reason EvictReason) {
 		// 存储被删除的key
 		keys = append(keys, key)
 	}
@@ -84,3 +85,88 @@ func TestOnEvicted(t *testing.T) {
 		t.Fatalf("Call OnEvicted failed, expect keys equals to %s", expect)
 	}
 }
+
+func TestExpire(t *testing.T) {
+	// 测试逻辑
+	// 测试步骤：
+	// 1. 添加key1，过期时间为10ms后；添加key2，永不过期
+	// 2. 立即获取key1，判断key1存在
+	// 3. 等待key1过期后再次获取，判断key1不存在，且OnEvicted收到过期原因
+	// 4. 获取key2，判断key2仍然存在
+	var reasons []EvictReason
+	lru := New(int64(0), func(key string, value Value, reason EvictReason) {
+		reasons = append(reasons, reason)
+	})
+	lru.AddWithExpire("key1", String("1234"), time.Now().Add(10*time.Millisecond))
+	lru.Add("key2", String("5678"))
+	if _, ok := lru.Get("key1"); !ok {
+		t.Fatalf("cache hit key1 before expire failed")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 1 {
+		t.Fatalf("cache miss key1 after expire failed")
+	}
+	if !reflect.DeepEqual(reasons, []EvictReason{EvictExpired}) {
+		t.Fatalf("expect reasons %v, got %v", []EvictReason{EvictExpired}, reasons)
+	}
+	if _, ok := lru.Get("key2"); !ok {
+		t.Fatalf("cache hit key2 failed")
+	}
+}
+
+func TestRemoveExpired(t *testing.T) {
+	// 测试逻辑
+	// 测试步骤：
+	// 1. 添加k1、k2为已过期的缓存项，k3永不过期
+	// 2. 调用RemoveExpired，判断删除了2个缓存项，且只剩k3
+	keys := make([]string, 0)
+	lru := New(int64(0), func(key string, value Value, reason EvictReason) {
+		if reason == EvictExpired {
+			keys = append(keys, key)
+		}
+	})
+	past := time.Now().Add(-time.Second)
+	lru.AddWithExpire("k1", String("v1"), past)
+	lru.AddWithExpire("k2", String("v2"), past)
+	lru.Add("k3", String("v3"))
+	if n := lru.RemoveExpired(); n != 2 || lru.Len() != 1 {
+		t.Fatalf("RemoveExpired failed, removed %d, left %d", n, lru.Len())
+	}
+	if !reflect.DeepEqual(keys, []string{"k1", "k2"}) {
+		t.Fatalf("expect expired keys %v, got %v", []string{"k1", "k2"}, keys)
+	}
+}
+
+func TestRange(t *testing.T) {
+	// 测试逻辑
+	// 测试步骤：
+	// 1. 依次添加k1、k2、k3，再访问k1，k2设置过期时间
+	// 2. Range按从旧到新的顺序返回k2、k3、k1，并带上过期时间
+	// 3. fn返回false时停止遍历
+	lru := New(int64(0), nil)
+	expire := time.Now().Add(time.Hour)
+	lru.Add("k1", String("v1"))
+	lru.AddWithExpire("k2", String("v2"), expire)
+	lru.Add("k3", String("v3"))
+	lru.Get("k1")
+
+	var keys []string
+	lru.Range(func(key string, value Value, e time.Time) bool {
+		keys = append(keys, key)
+		if key == "k2" && !e.Equal(expire) {
+			t.Fatalf("expect k2 expire %v, got %v", expire, e)
+		}
+		return true
+	})
+	if !reflect.DeepEqual(keys, []string{"k2", "k3", "k1"}) {
+		t.Fatalf("expect range order %v, got %v", []string{"k2", "k3", "k1"}, keys)
+	}
+	n := 0
+	lru.Range(func(string, Value, time.Time) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Fatalf("Range should stop after fn returns false, called %d times", n)
+	}
+}
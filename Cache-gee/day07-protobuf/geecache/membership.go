@@ -0,0 +1,226 @@
+package geecache
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// 健康检查路径，相对于 basePath
+	defaultHealthPath = "_health"
+	// 成员列表路径，相对于 basePath
+	defaultMembersPath = "_members"
+	// 连续探测失败多少次后将节点移出哈希环
+	defaultMaxFails = 3
+)
+
+// Member 集群中的一个节点
+type Member struct {
+	Addr string `json:"addr"`
+	// 是否健康，只有健康的节点在哈希环上
+	Alive bool `json:"alive"`
+	// 是否是当前节点
+	Self bool `json:"self"`
+	// 权重，权重越大分到的 key 越多
+	Weight int `json:"weight"`
+}
+
+// 节点的健康状态
+type member struct {
+	alive  bool
+	weight int
+	// 连续探测失败的次数
+	fails int
+}
+
+// AddPeer 向集群中添加节点，已存在的节点会被忽略
+func (p *HTTPPool) AddPeer(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.members == nil {
+		p.members = make(map[string]*member)
+		p.httpGetters = make(map[string]*httpGetter)
+	}
+	for _, peer := range peers {
+		if _, ok := p.members[peer]; ok {
+			continue
+		}
+		p.members[peer] = &member{alive: true, weight: 1}
+		p.httpGetters[peer] = p.newGetter(peer)
+	}
+	p.rebuild()
+}
+
+// RemovePeer 将节点从集群中删除
+func (p *HTTPPool) RemovePeer(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, peer := range peers {
+		delete(p.members, peer)
+		delete(p.httpGetters, peer)
+	}
+	p.rebuild()
+}
+
+// SetWeight 设置节点的权重，性能更好的节点可以设置更大的权重
+func (p *HTTPPool) SetWeight(peer string, weight int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if m, ok := p.members[peer]; ok {
+		m.weight = weight
+		p.rebuild()
+	}
+}
+
+// Members 返回集群中的所有节点，按地址排序
+func (p *HTTPPool) Members() []Member {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	members := make([]Member, 0, len(p.members))
+	for addr, m := range p.members {
+		members = append(members, Member{Addr: addr, Alive: m.alive, Self: addr == p.self, Weight: m.weight})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Addr < members[j].Addr })
+	return members
+}
+
+// 用健康的节点重建哈希环，调用方需持有锁
+func (p *HTTPPool) rebuild() {
+	p.peers = p.newRing()
+	// 按地址顺序添加，使 Jump 这类依赖加入顺序的算法在各节点上结果一致
+	addrs := make([]string, 0, len(p.members))
+	for addr := range p.members {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		if m := p.members[addr]; m.alive {
+			p.peers.AddWeighted(addr, m.weight)
+		}
+	}
+}
+
+// StartHealthCheck 每隔 interval 探测一次其他节点，
+// 连续 defaultMaxFails 次探测失败的节点被移出哈希环，恢复后重新加入
+func (p *HTTPPool) StartHealthCheck(interval time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopHealth != nil {
+		return
+	}
+	p.stopHealth = make(chan struct{})
+	// 与节点间请求共用 Transport，TLS 配置相同
+	client := &http.Client{Timeout: interval, Transport: p.opts.Client.Transport}
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.probe(client)
+			case <-stop:
+				return
+			}
+		}
+	}(p.stopHealth)
+}
+
+// StopHealthCheck 停止健康检查
+func (p *HTTPPool) StopHealthCheck() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopHealth != nil {
+		close(p.stopHealth)
+		p.stopHealth = nil
+	}
+}
+
+// 并发探测除自身以外的所有节点，并根据结果更新哈希环
+func (p *HTTPPool) probe(client *http.Client) {
+	p.mu.Lock()
+	var addrs []string
+	for addr := range p.members {
+		if addr != p.self {
+			addrs = append(addrs, addr)
+		}
+	}
+	p.mu.Unlock()
+
+	healthy := make([]bool, len(addrs))
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			res, err := client.Get(addr + p.basePath + defaultHealthPath)
+			if err != nil {
+				return
+			}
+			res.Body.Close()
+			healthy[i] = res.StatusCode == http.StatusOK
+		}(i, addr)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	changed := false
+	for i, addr := range addrs {
+		// 探测期间节点可能已被删除
+		m, ok := p.members[addr]
+		if !ok {
+			continue
+		}
+		if healthy[i] {
+			m.fails = 0
+			if !m.alive {
+				m.alive = true
+				changed = true
+				p.Log("peer %s is back", addr)
+			}
+			continue
+		}
+		m.fails++
+		if m.alive && m.fails >= defaultMaxFails {
+			m.alive = false
+			changed = true
+			p.Log("peer %s is down", addr)
+		}
+	}
+	if changed {
+		p.rebuild()
+	}
+}
+
+// 查看和修改集群成员：GET 返回成员列表，POST 和 DELETE 通过 peer 参数添加、删除节点。
+// 修改只对接收请求的节点生效，不会同步给其他节点，需要对每个节点分别调用，否则各节点的哈希环不一致。
+// 修改成员必须配置 Secret，未签名的请求会被拒绝，避免任何能访问节点端口的人改写哈希环
+func (p *HTTPPool) serveMembers(w http.ResponseWriter, r *http.Request) {
+	peer := r.URL.Query().Get("peer")
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodDelete:
+		if len(p.opts.Secret) == 0 {
+			http.Error(w, "changing members requires HTTPPoolOptions.Secret", http.StatusForbidden)
+			return
+		}
+		if peer == "" {
+			http.Error(w, "peer is required", http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodPost {
+			p.AddPeer(peer)
+		} else {
+			p.RemovePeer(peer)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p.Members())
+}
@@ -0,0 +1,58 @@
+package geecache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// 一项导出的指标
+type metric struct {
+	name string
+	// counter 或 gauge
+	typ   string
+	help  string
+	value func(s Stats) int64
+}
+
+var metrics = []metric{
+	{"geecache_gets_total", "counter", "Total number of Get requests.", func(s Stats) int64 { return s.Gets }},
+	{"geecache_hits_total", "counter", "Get requests served from the main or hot cache.", func(s Stats) int64 { return s.Hits }},
+	{"geecache_stale_hits_total", "counter", "Hits on values past their soft TTL, served while refreshing.", func(s Stats) int64 { return s.StaleHits }},
+	{"geecache_disk_hits_total", "counter", "Hits served from the disk tier after a memory miss.", func(s Stats) int64 { return s.DiskHits }},
+	{"geecache_misses_total", "counter", "Get requests that missed the local caches.", func(s Stats) int64 { return s.Misses }},
+	{"geecache_negative_hits_total", "counter", "Get requests answered from the not-found cache.", func(s Stats) int64 { return s.NegativeHits }},
+	{"geecache_peer_loads_total", "counter", "Values successfully loaded from a remote peer.", func(s Stats) int64 { return s.PeerLoads }},
+	{"geecache_peer_errors_total", "counter", "Failed loads from a remote peer.", func(s Stats) int64 { return s.PeerErrors }},
+	{"geecache_local_loads_total", "counter", "Values successfully loaded by the getter.", func(s Stats) int64 { return s.LocalLoads }},
+	{"geecache_local_load_errors_total", "counter", "Failed loads by the getter.", func(s Stats) int64 { return s.LocalLoadErrs }},
+	{"geecache_dedups_total", "counter", "Loads merged into a concurrent in-flight load.", func(s Stats) int64 { return s.Dedups }},
+	{"geecache_evictions_total", "counter", "Entries evicted for capacity or expiry.", func(s Stats) int64 { return s.Evictions }},
+	{"geecache_bytes", "gauge", "Bytes held in the main and hot caches.", func(s Stats) int64 { return s.Bytes }},
+	{"geecache_items", "gauge", "Entries held in the main and hot caches.", func(s Stats) int64 { return s.Items }},
+}
+
+// WriteMetrics 以 Prometheus 文本格式输出所有缓存组的统计信息，
+// 每个缓存组一个 group 标签
+func WriteMetrics(w io.Writer) error {
+	mu.RLock()
+	names := make([]string, 0, len(groups))
+	stats := make(map[string]Stats, len(groups))
+	for name, g := range groups {
+		names = append(names, name)
+		stats[name] = g.Stats()
+	}
+	mu.RUnlock()
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(bw, "# TYPE %s %s\n", m.name, m.typ)
+		for _, name := range names {
+			fmt.Fprintf(bw, "%s{group=%q} %d\n", m.name, name, m.value(stats[name]))
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,73 @@
+package geecache
+
+import "time"
+
+// GroupOption 创建缓存组时的可选配置
+type GroupOption func(*Group)
+
+// WithTTL 设置缓存值的默认有效期
+func WithTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.ttl = ttl
+	}
+}
+
+// WithJanitor 设置后台清理过期缓存的间隔
+func WithJanitor(interval time.Duration) GroupOption {
+	return func(g *Group) {
+		g.janitorInterval = interval
+	}
+}
+
+// WithPolicy 设置缓存淘汰策略，默认为 LRU
+func WithPolicy(p PolicyFunc) GroupOption {
+	return func(g *Group) {
+		g.policy = p
+	}
+}
+
+// WithShards 将本地缓存分成 n 个独立加锁的分片，默认为 1 个分片
+func WithShards(n int) GroupOption {
+	return func(g *Group) {
+		g.shards = n
+	}
+}
+
+// WithSoftTTL 设置缓存值的软有效期。超过软有效期后 Get 仍直接返回旧值，
+// 同时在后台重新加载一次；加载失败时继续返回旧值，直到 WithTTL 设置的有效期到期
+func WithSoftTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.softTTL = ttl
+	}
+}
+
+// WithNegativeTTL 设置不存在的 key 的缓存时间。回调函数返回包装了 ErrNotFound 的错误后，
+// ttl 内再次获取该 key 直接返回 ErrNotFound，不再访问数据源
+func WithNegativeTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.negativeTTL = ttl
+	}
+}
+
+// WithMaxValueBytes 设置缓存值的最大长度，回调函数返回或 Set 写入更长的值时返回 ErrValueTooLarge，
+// 不会被缓存。0 表示不限制
+func WithMaxValueBytes(n int64) GroupOption {
+	return func(g *Group) {
+		g.maxValueBytes = n
+	}
+}
+
+// WithDiskTier 使用磁盘缓存作为 mainCache 的二级缓存，mainCache 因容量不足淘汰的缓存项写入磁盘，
+// 未命中内存时先从磁盘读取。d 由 OpenDiskTier 创建，不能同时用于多个缓存组
+func WithDiskTier(d *DiskTier) GroupOption {
+	return func(g *Group) {
+		g.disk = d
+	}
+}
+
+// WithHotCache 设置 hotCache 的最大字节数，默认为 cacheBytes 的 1/8，小于 0 表示不使用 hotCache
+func WithHotCache(bytes int64) GroupOption {
+	return func(g *Group) {
+		g.hotCacheBytes = bytes
+	}
+}
@@ -1,11 +1,33 @@
 package geecache
 
-import pb "geecache/geecachepb"
+import (
+	"context"
+	pb "geecache/geecachepb"
+)
 
 type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
+	// GetAll 返回除自身以外的所有节点，用于广播失效
+	GetAll() []PeerGetter
 }
 
+// OwnerPicker 可选接口，返回哈希环上负责 key 的节点。
+// PickPeer 可能出于负载均衡把 key 交给其他节点，写操作必须发给真正的负责节点
+type OwnerPicker interface {
+	PickOwner(key string) (peer PeerGetter, ok bool)
+}
+
+// PeerGetter 远程节点的客户端，ctx 的截止时间会随请求转发给远程节点。
+// 支持批量请求的客户端还可以实现 BatchPeerGetter
 type PeerGetter interface {
-	Get(in *pb.Request, out *pb.Response) error
+	Get(ctx context.Context, in *pb.Request, out *pb.Response) error
+	// Set 将缓存值写入远程节点的本地缓存
+	Set(ctx context.Context, in *pb.SetRequest, out *pb.Response) error
+	// Remove 删除远程节点本地缓存中的缓存值
+	Remove(ctx context.Context, in *pb.Request, out *pb.Response) error
+}
+
+// BatchPeerGetter 可选接口，一次请求从远程节点获取多个 key
+type BatchPeerGetter interface {
+	GetMulti(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error
 }
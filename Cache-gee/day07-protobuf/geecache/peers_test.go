@@ -0,0 +1,187 @@
+package geecache
+
+import (
+	"context"
+	"fmt"
+	pb "geecache/geecachepb"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 多节点测试会以子进程的方式重新运行测试程序，每个子进程是一个缓存节点。
+// 子进程通过环境变量获取传输方式、自身地址和全部节点地址
+const (
+	childTransportEnv = "GEECACHE_TEST_TRANSPORT"
+	childSelfEnv      = "GEECACHE_TEST_SELF"
+	childPeersEnv     = "GEECACHE_TEST_PEERS"
+	// 多节点测试使用的缓存组
+	peerGroupName = "peertest"
+)
+
+// peerTransport 描述一种节点间的传输方式，多节点测试对每种传输方式运行同样的用例
+type peerTransport struct {
+	name string
+	// 由 host:port 得到节点地址
+	addr func(hostport string) string
+	// 创建节点池，返回节点选择器和查询 key 所属节点的函数
+	newPool func(self string, peers []string) (PeerPicker, func(key string) string)
+	// 直接访问某个节点
+	getter func(t *testing.T, addr string) PeerGetter
+	// 在子进程中启动节点服务
+	serve func(self string, peers PeerPicker) error
+}
+
+var transports = map[string]peerTransport{
+	"http": {
+		name: "http",
+		addr: func(hostport string) string { return "http://" + hostport },
+		newPool: func(self string, peers []string) (PeerPicker, func(string) string) {
+			pool := NewHTTPPool(self)
+			pool.Set(peers...)
+			return pool, pool.peers.Get
+		},
+		getter: func(t *testing.T, addr string) PeerGetter {
+			return NewHTTPPool("").newGetter(addr)
+		},
+		serve: func(self string, peers PeerPicker) error {
+			return http.ListenAndServe(strings.TrimPrefix(self, "http://"), peers.(*HTTPPool))
+		},
+	},
+}
+
+// 子进程中运行的缓存节点，回调函数返回的值带有节点地址，便于判断数据来自哪个节点
+func TestPeerChild(t *testing.T) {
+	tr, ok := transports[os.Getenv(childTransportEnv)]
+	if !ok {
+		t.Skip("not a child process")
+	}
+	self := os.Getenv(childSelfEnv)
+	peers, _ := tr.newPool(self, strings.Split(os.Getenv(childPeersEnv), ","))
+	NewGroup(peerGroupName, 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key + "@" + self), nil
+		})).RegisterPeers(peers)
+	t.Fatal(tr.serve(self, peers))
+}
+
+// 选取空闲端口，启动 n 个子进程节点，返回节点地址
+func startPeers(t *testing.T, tr peerTransport, n int) []string {
+	hostports := make([]string, n)
+	addrs := make([]string, n)
+	for i := range addrs {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		hostports[i] = l.Addr().String()
+		addrs[i] = tr.addr(hostports[i])
+		l.Close()
+	}
+	for _, addr := range addrs {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestPeerChild$")
+		cmd.Env = append(os.Environ(),
+			childTransportEnv+"="+tr.name,
+			childSelfEnv+"="+addr,
+			childPeersEnv+"="+strings.Join(addrs, ","),
+		)
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+		})
+	}
+	// 等待所有节点开始监听
+	for _, hostport := range hostports {
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			conn, err := net.Dial("tcp", hostport)
+			if err == nil {
+				conn.Close()
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("peer %s not ready: %v", hostport, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	return addrs
+}
+
+// 测试多节点之间的读写
+// 测试步骤
+//  1. 启动3个子进程节点，本进程的缓存组只作为客户端，所有 key 都由子进程节点负责
+//  2. Get 和 GetMulti 的结果来自一致性哈希选出的节点
+//  3. Set 写入负责该 key 的节点，之后 Get 得到新值
+//  4. 在非负责节点上写入旧副本，Remove 之后旧副本被广播删除。节点间的请求不再转发，
+//     该节点在本地重新加载；本进程的 Get 重新从负责节点加载
+func testPeers(t *testing.T, tr peerTransport) {
+	addrs := startPeers(t, tr, 3)
+	pool, ownerOf := tr.newPool(tr.addr("127.0.0.1:0"), addrs)
+	gee := NewGroup(peerGroupName, 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key + "@local"), nil
+		}))
+	gee.RegisterPeers(pool)
+
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key%d", i)
+		owner := ownerOf(key)
+		if v, err := gee.Get(key); err != nil || v.String() != key+"@"+owner {
+			t.Fatalf("Get(%s) = %q, %v; want value from %s", key, v, err, owner)
+		}
+	}
+
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+	values, err := gee.GetMulti(context.Background(), keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if owner := ownerOf(key); values[key].String() != key+"@"+owner {
+			t.Fatalf("GetMulti[%s] = %q; want value from %s", key, values[key], owner)
+		}
+	}
+
+	if err := gee.Set("Tom", []byte("630")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("Get after Set = %q, %v; want 630", v, err)
+	}
+
+	owner := ownerOf("Tom")
+	var other string
+	for _, addr := range addrs {
+		if addr != owner {
+			other = addr
+			break
+		}
+	}
+	stale := tr.getter(t, other)
+	if err := stale.Set(context.Background(), &pb.SetRequest{Group: peerGroupName, Key: "Tom", Value: []byte("stale")}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	res := &pb.Response{}
+	if err := stale.Get(context.Background(), &pb.Request{Group: peerGroupName, Key: "Tom"}, res); err != nil || string(res.Value) != "stale" {
+		t.Fatalf("expect stale copy on %s, got %q, %v", other, res.Value, err)
+	}
+
+	if err := gee.Remove("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	res = &pb.Response{}
+	if err := stale.Get(context.Background(), &pb.Request{Group: peerGroupName, Key: "Tom"}, res); err != nil || string(res.Value) != "Tom@"+other {
+		t.Fatalf("stale copy should be invalidated, got %q, %v", res.Value, err)
+	}
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "Tom@"+owner {
+		t.Fatalf("Get after Remove = %q, %v; want reloaded by %s", v, err, owner)
+	}
+}
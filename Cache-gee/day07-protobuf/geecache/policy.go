@@ -0,0 +1,64 @@
+package geecache
+
+import (
+	"geecache/arc"
+	"geecache/lfu"
+	"geecache/lru"
+	"geecache/tinylfu"
+	"geecache/twoq"
+	"time"
+)
+
+// Policy 缓存淘汰策略。
+// 各实现统一按 lru.Value 的 Len() 计算字节数，并通过 OnEvicted 回调通知被移除的缓存项
+type Policy interface {
+	Get(key string) (value lru.Value, ok bool)
+	// 返回缓存值，不影响淘汰顺序和访问频率
+	Peek(key string) (value lru.Value, ok bool)
+	AddWithExpire(key string, value lru.Value, expire time.Time)
+	Remove(key string)
+	// 按策略淘汰一个缓存项
+	RemoveOldest()
+	// 修改最大字节数，超出新上限的部分立即淘汰
+	SetMaxBytes(maxBytes int64)
+	RemoveExpired() int
+	// 按淘汰顺序遍历缓存项，最先被淘汰的最先遍历
+	Range(fn func(key string, value lru.Value, expire time.Time) bool)
+	Len() int
+	Bytes() int64
+}
+
+// PolicyFunc 根据最大字节数和淘汰回调创建淘汰策略
+type PolicyFunc func(maxBytes int64, onEvicted func(string, lru.Value, lru.EvictReason)) Policy
+
+var (
+	// LRU 淘汰最久未使用的缓存项，默认策略
+	LRU PolicyFunc = func(maxBytes int64, onEvicted func(string, lru.Value, lru.EvictReason)) Policy {
+		return lru.New(maxBytes, onEvicted)
+	}
+	// LFU 淘汰访问次数最少的缓存项
+	LFU PolicyFunc = func(maxBytes int64, onEvicted func(string, lru.Value, lru.EvictReason)) Policy {
+		return lfu.New(maxBytes, onEvicted)
+	}
+	// ARC 在最近访问和频繁访问之间自适应
+	ARC PolicyFunc = func(maxBytes int64, onEvicted func(string, lru.Value, lru.EvictReason)) Policy {
+		return arc.New(maxBytes, onEvicted)
+	}
+	// TwoQ 只访问一次的数据不会进入主队列，能抵抗扫描
+	TwoQ PolicyFunc = func(maxBytes int64, onEvicted func(string, lru.Value, lru.EvictReason)) Policy {
+		return twoq.New(maxBytes, onEvicted)
+	}
+	// TinyLFU 按近似访问频率决定新数据能否进入主缓存
+	TinyLFU PolicyFunc = func(maxBytes int64, onEvicted func(string, lru.Value, lru.EvictReason)) Policy {
+		return tinylfu.New(maxBytes, onEvicted)
+	}
+)
+
+// 编译期检查各策略是否实现了 Policy 接口
+var (
+	_ Policy = (*lru.Cache)(nil)
+	_ Policy = (*lfu.Cache)(nil)
+	_ Policy = (*arc.Cache)(nil)
+	_ Policy = (*twoq.Cache)(nil)
+	_ Policy = (*tinylfu.Cache)(nil)
+)
@@ -0,0 +1,181 @@
+package geecache
+
+import (
+	"bufio"
+	"geecache/lru"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// 用于命中率测试的缓存值，每个值固定 64 字节
+type fixedValue struct{}
+
+func (fixedValue) Len() int { return 64 }
+
+var policies = []struct {
+	name string
+	fn   PolicyFunc
+}{
+	{"LRU", LRU},
+	{"LFU", LFU},
+	{"ARC", ARC},
+	{"2Q", TwoQ},
+	{"TinyLFU", TinyLFU},
+}
+
+// 读取 testdata 中录制的访问序列，每行一个 key
+func loadTrace(t testing.TB, name string) []string {
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var keys []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		keys = append(keys, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+// 回放访问序列，未命中时写入缓存，返回命中率
+func hitRatio(fn PolicyFunc, maxBytes int64, keys []string) float64 {
+	p := fn(maxBytes, nil)
+	hits := 0
+	for _, key := range keys {
+		if _, ok := p.Get(key); ok {
+			hits++
+			continue
+		}
+		p.AddWithExpire(key, fixedValue{}, time.Time{})
+		if p.Bytes() > maxBytes {
+			panic("policy exceeds maxBytes")
+		}
+	}
+	return float64(hits) / float64(len(keys))
+}
+
+// 测试各淘汰策略在录制的访问序列上的命中率
+// 测试步骤
+//  1. zipf.trace：符合 Zipf 分布的访问，各策略命中率应接近或优于 LRU
+//  2. scan.trace：热点数据中穿插一次性的顺序扫描，扫描会冲掉 LRU 中的热点数据，
+//     频率感知的策略和 2Q 应优于 LRU
+//  3. loop.trace：循环访问略大于容量的数据集，LRU 命中率为 0，2Q 和 TinyLFU 能保留部分数据
+func TestPolicyHitRatio(t *testing.T) {
+	const maxBytes = 500 * (64 + 5)
+	traces := []string{"zipf.trace", "scan.trace", "loop.trace"}
+	for _, trace := range traces {
+		keys := loadTrace(t, trace)
+		ratios := make(map[string]float64, len(policies))
+		for _, p := range policies {
+			ratios[p.name] = hitRatio(p.fn, maxBytes, keys)
+			t.Logf("%-10s %-8s hit ratio %.4f", trace, p.name, ratios[p.name])
+		}
+		// 各访问序列上期望优于 LRU 的策略
+		better := map[string][]string{
+			"zipf.trace": {"LFU", "ARC", "2Q", "TinyLFU"},
+			"scan.trace": {"LFU", "ARC", "2Q", "TinyLFU"},
+			"loop.trace": {"2Q", "TinyLFU"},
+		}
+		for _, name := range better[trace] {
+			if ratios[name] <= ratios["LRU"] {
+				t.Errorf("%s: %s hit ratio %.4f should beat LRU %.4f", trace, name, ratios[name], ratios["LRU"])
+			}
+		}
+	}
+}
+
+// 测试切换淘汰策略后缓存组仍能正常工作，且各策略都会触发 OnEvicted
+func TestPolicyOnEvicted(t *testing.T) {
+	for _, p := range policies {
+		evicted := 0
+		c := p.fn(int64(10), func(key string, value lru.Value, reason lru.EvictReason) {
+			evicted++
+		})
+		for _, k := range []string{"k1", "k2", "k3", "k4", "k5", "k6"} {
+			c.AddWithExpire(k, ByteView{b: []byte("v")}, time.Time{})
+		}
+		if c.Bytes() > 10 || evicted == 0 || c.Len()+evicted != 6 {
+			t.Fatalf("%s: bytes %d, len %d, evicted %d", p.name, c.Bytes(), c.Len(), evicted)
+		}
+	}
+
+	gee := NewGroup("policy", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithPolicy(TinyLFU))
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "Tom" {
+		t.Fatalf("get with TinyLFU policy failed")
+	}
+}
+
+// 测试 Peek 没有副作用
+// 测试步骤
+//  1. 两个相同策略的缓存执行相同的写入和访问，其中一个额外 Peek 所有 key
+//  2. 继续写入触发淘汰后，两者保留的缓存项和淘汰顺序完全相同
+func TestPolicyPeek(t *testing.T) {
+	const size = 2 + 64
+	for _, p := range policies {
+		plain, peeked := p.fn(8*size, nil), p.fn(8*size, nil)
+		for i := 10; i < 40; i++ {
+			key := strconv.Itoa(i)
+			for _, c := range []Policy{plain, peeked} {
+				c.Get(strconv.Itoa(i - i%3))
+				c.AddWithExpire(key, fixedValue{}, time.Time{})
+			}
+			for j := 10; j <= i; j++ {
+				if _, ok := peeked.Peek(strconv.Itoa(j)); ok {
+					if _, ok := plain.Peek(strconv.Itoa(j)); !ok {
+						t.Fatalf("%s: Peek(%d) found an entry missing from the other cache", p.name, j)
+					}
+				}
+			}
+		}
+		order := func(c Policy) (keys []string) {
+			c.Range(func(key string, value lru.Value, expire time.Time) bool {
+				keys = append(keys, key)
+				return true
+			})
+			return keys
+		}
+		if a, b := order(plain), order(peeked); !slices.Equal(a, b) {
+			t.Fatalf("%s: Peek changed eviction order: %v vs %v", p.name, a, b)
+		}
+	}
+}
+
+// 测试运行时缩小容量
+// 测试步骤
+//  1. 写入 20 个缓存项后将容量缩小一半，超出的部分立即以 EvictCapacity 淘汰
+//  2. 之后继续写入也不会超过新的容量
+func TestPolicySetMaxBytes(t *testing.T) {
+	const size = 3 + 64
+	for _, p := range policies {
+		evicted := 0
+		c := p.fn(20*size, func(key string, value lru.Value, reason lru.EvictReason) {
+			if reason == lru.EvictCapacity {
+				evicted++
+			}
+		})
+		for i := 100; i < 120; i++ {
+			c.AddWithExpire(strconv.Itoa(i), fixedValue{}, time.Time{})
+		}
+		c.SetMaxBytes(10 * size)
+		if c.Bytes() > 10*size || c.Len()+evicted != 20 {
+			t.Fatalf("%s: bytes %d, len %d, evicted %d after shrinking", p.name, c.Bytes(), c.Len(), evicted)
+		}
+		for i := 200; i < 220; i++ {
+			c.AddWithExpire(strconv.Itoa(i), fixedValue{}, time.Time{})
+			if c.Bytes() > 10*size {
+				t.Fatalf("%s: bytes %d exceed the new limit", p.name, c.Bytes())
+			}
+		}
+	}
+}
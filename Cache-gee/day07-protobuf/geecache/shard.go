@@ -0,0 +1,124 @@
+package geecache
+
+// shardedCache 将缓存按 key 的哈希值分成多个分片，每个分片独立加锁，
+// 不同分片上的读写互不阻塞，减少多核下的锁竞争
+type shardedCache struct {
+	shards []*cache
+}
+
+// 创建分片缓存，各分片的最大字节数之和等于 cacheBytes，cacheBytes 小于分片数时每个分片至少 1 字节
+func newShardedCache(n int, cacheBytes int64, newPolicy PolicyFunc) *shardedCache {
+	if n <= 0 {
+		n = 1
+	}
+	s := &shardedCache{shards: make([]*cache, n)}
+	for i := range s.shards {
+		s.shards[i] = &cache{cacheBytes: shardBytes(cacheBytes, n, i), newPolicy: newPolicy}
+	}
+	return s
+}
+
+// 第 i 个分片的最大字节数，余数分给前面的分片
+func shardBytes(cacheBytes int64, n, i int) int64 {
+	bytes := cacheBytes / int64(n)
+	if int64(i) < cacheBytes%int64(n) {
+		bytes++
+	}
+	// 0 表示不限制，有上限的缓存不能分出不限制的分片
+	if cacheBytes > 0 && bytes == 0 {
+		bytes = 1
+	}
+	return bytes
+}
+
+// 按比例分出的字节数，cacheBytes 大于 0 时至少为 1，避免被当作不限制
+func fractionBytes(cacheBytes int64, ratio int64) int64 {
+	if cacheBytes <= 0 {
+		return cacheBytes
+	}
+	return max(cacheBytes/ratio, 1)
+}
+
+// 修改总的最大字节数，按创建时的方式分给各分片
+func (s *shardedCache) setMaxBytes(cacheBytes int64) {
+	for i, c := range s.shards {
+		c.setMaxBytes(shardBytes(cacheBytes, len(s.shards), i))
+	}
+}
+
+// 设置所有分片因容量不足淘汰缓存项时的处理函数
+func (s *shardedCache) setSpill(fn func(key string, value ByteView, claim func() bool)) {
+	for _, c := range s.shards {
+		c.spill = fn
+	}
+}
+
+// 删除所有分片中的缓存项
+func (s *shardedCache) clear() {
+	for _, c := range s.shards {
+		c.clear()
+	}
+}
+
+// 根据 key 的 FNV-1a 哈希值选择分片
+func (s *shardedCache) shard(key string) *cache {
+	if len(s.shards) == 1 {
+		return s.shards[0]
+	}
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return s.shards[h%uint32(len(s.shards))]
+}
+
+func (s *shardedCache) add(key string, value ByteView) {
+	s.shard(key).add(key, value)
+}
+
+func (s *shardedCache) get(key string) (value ByteView, ok bool) {
+	return s.shard(key).get(key)
+}
+
+func (s *shardedCache) peek(key string) (value ByteView, ok bool) {
+	return s.shard(key).peek(key)
+}
+
+func (s *shardedCache) remove(key string) {
+	s.shard(key).remove(key)
+}
+
+// 清理所有分片中已过期的缓存项，返回清理的数量
+func (s *shardedCache) removeExpired() int {
+	n := 0
+	for _, c := range s.shards {
+		n += c.removeExpired()
+	}
+	return n
+}
+
+// 依次返回各分片的缓存项。同一个 key 总是落在同一个分片，
+// 按顺序重新添加可以恢复每个分片内的淘汰顺序
+func (s *shardedCache) entries() []cacheEntry {
+	var entries []cacheEntry
+	for _, c := range s.shards {
+		entries = append(entries, c.entries()...)
+	}
+	return entries
+}
+
+// 汇总所有分片的统计信息
+func (s *shardedCache) stats() CacheStats {
+	var total CacheStats
+	for _, c := range s.shards {
+		st := c.stats()
+		total.MaxBytes += st.MaxBytes
+		total.Bytes += st.Bytes
+		total.Items += st.Items
+		total.Gets += st.Gets
+		total.Hits += st.Hits
+		total.Evictions += st.Evictions
+	}
+	return total
+}
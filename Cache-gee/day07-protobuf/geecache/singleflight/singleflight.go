@@ -1,11 +1,56 @@
 package singleflight
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// ErrGoexit fn 调用了 runtime.Goexit，DoChan 的调用方会收到该错误
+var ErrGoexit = errors.New("singleflight: fn called runtime.Goexit")
+
+// PanicError fn panic 时保存 panic 的值和堆栈。
+// Do 和 DoContext 的所有调用方都会以 *PanicError 重新 panic，DoChan 的调用方在 Result.Err 中收到它
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("singleflight: fn panicked: %v\n\n%s", p.Value, p.Stack)
+}
+
+func (p *PanicError) Unwrap() error {
+	err, _ := p.Value.(error)
+	return err
+}
+
+// Result DoChan 返回的调用结果，Shared 表示结果是否被多个调用方共享
+type Result struct {
+	Val    interface{}
+	Err    error
+	Shared bool
+}
 
 type Call struct {
-	wg  sync.WaitGroup
-	val interface{}
-	err error
+	// 调用结束后关闭
+	done chan struct{}
+	val  interface{}
+	err  error
+	// fn 是否因为自身的 context 超时或被取消而结束
+	ctxErr bool
+	// 正在等待结果的调用方数量，降为 0 时取消 fn 的 context
+	waiters int
+	// 加入调用的次数，不随调用方离开而减少
+	dups int
+	// 取消 fn 使用的 context，Do 发起的调用为 nil
+	cancel context.CancelFunc
+	// fn 的 context 的截止时间，零值表示没有截止时间
+	deadline time.Time
 }
 
 type Group struct {
@@ -13,26 +58,179 @@ type Group struct {
 	calls map[string]*Call
 }
 
-func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
-	g.mu.Lock()
-	if g.calls == nil {
-		g.calls = make(map[string]*Call)
+// Do 执行 fn 并返回结果，同一个 key 同时只有一个 fn 在执行，其余调用方等待并共享结果。
+// shared 表示结果是否被多个调用方共享。fn panic 时所有调用方都会 panic，
+// fn 调用 runtime.Goexit 时所有调用方的 goroutine 都会退出
+func (g *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	v, err, shared = g.do(key, fn)
+	return v, rethrow(err), shared
+}
+
+// DoChan 与 Do 相同，但不阻塞，结果通过返回的 channel 传递。
+// fn panic 或调用 runtime.Goexit 时，Result.Err 为 *PanicError 或 ErrGoexit
+func (g *Group) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	ch := make(chan Result, 1)
+	go func() {
+		// fn 在本 goroutine 中调用 runtime.Goexit 时，只有 defer 还会执行
+		res := Result{Err: ErrGoexit}
+		defer func() { ch <- res }()
+		res.Val, res.Err, res.Shared = g.do(key, fn)
+	}()
+	return ch
+}
+
+// 发起或加入调用并等待结果，fn 的 panic 以 *PanicError 返回
+func (g *Group) do(key string, fn func() (interface{}, error)) (interface{}, error, bool) {
+	for {
+		g.mu.Lock()
+		if g.calls == nil {
+			g.calls = make(map[string]*Call)
+		}
+		if c, ok := g.calls[key]; ok {
+			c.waiters++
+			c.dups++
+			g.mu.Unlock()
+			<-c.done
+			// 加入的是 DoContext 发起的调用且其 context 已超时，重新发起调用
+			if c.ctxErr {
+				continue
+			}
+			return c.val, c.err, true
+		}
+		c := &Call{done: make(chan struct{}), waiters: 1}
+		g.calls[key] = c
+		g.mu.Unlock()
+
+		g.doCall(key, c, fn)
+		return c.val, c.err, c.dups > 0
 	}
-	if v, ok := g.calls[key]; ok {
+}
+
+// DoContext 与 Do 相同，但调用方可以通过 ctx 放弃等待。
+// fn 在新的 goroutine 中执行，它的 context 继承发起调用方的值和截止时间，
+// 但不会因为某个调用方被取消而取消，只有所有调用方都放弃等待时才会被取消。
+// fn 因为其 context 超时而失败时，自身 ctx 仍然有效的调用方会重新发起调用，而不是得到该错误
+func (g *Group) DoContext(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (v interface{}, err error, shared bool) {
+	for {
+		g.mu.Lock()
+		if g.calls == nil {
+			g.calls = make(map[string]*Call)
+		}
+		c, ok := g.calls[key]
+		if !ok {
+			c = &Call{done: make(chan struct{})}
+			fctx := context.WithoutCancel(ctx)
+			if deadline, ok := ctx.Deadline(); ok {
+				c.deadline = deadline
+				fctx, c.cancel = context.WithDeadline(fctx, deadline)
+			} else {
+				fctx, c.cancel = context.WithCancel(fctx)
+			}
+			g.calls[key] = c
+			go g.doCall(key, c, func() (interface{}, error) {
+				defer c.cancel()
+				val, err := fn(fctx)
+				c.ctxErr = err != nil && fctx.Err() != nil
+				return val, err
+			})
+		} else {
+			c.dups++
+		}
+		c.waiters++
 		g.mu.Unlock()
-		v.wg.Wait()
-		return v.val, v.err
+
+		select {
+		case <-c.done:
+			if c.ctxErr && c.outlivedBy(ctx) {
+				continue
+			}
+			return c.val, rethrow(c.err), c.dups > 0
+		case <-ctx.Done():
+			g.leave(key, c)
+			return nil, ctx.Err(), false
+		}
 	}
-	c := new(Call)
-	c.wg.Add(1)
-	g.calls[key] = c
-	g.mu.Unlock()
-	c.val, c.err = fn()
-	c.wg.Done()
+}
 
+// 调用方的 ctx 是否比 fn 的 context 活得更久。调用方的截止时间不晚于 fn 的截止时间时，
+// 即使调用方的计时器还没有触发，fn 超时也意味着调用方超时
+func (c *Call) outlivedBy(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	deadline, ok := ctx.Deadline()
+	return !ok || deadline.After(c.deadline)
+}
+
+// Forget 让之后对 key 的调用重新执行 fn，不再共享正在进行的调用，
+// 已经在等待的调用方仍然得到这次调用的结果
+func (g *Group) Forget(key string) {
 	g.mu.Lock()
 	delete(g.calls, key)
 	g.mu.Unlock()
+}
+
+// 执行 fn 并结束调用。fn panic 时保存为 *PanicError，
+// fn 调用 runtime.Goexit 时保存为 ErrGoexit，两种情况都会唤醒等待的调用方
+func (g *Group) doCall(key string, c *Call, fn func() (interface{}, error)) {
+	normalReturn := false
+	recovered := false
+	defer func() {
+		// 既没有正常返回也没有 panic，说明 fn 调用了 runtime.Goexit
+		if !normalReturn && !recovered {
+			c.err = ErrGoexit
+		}
+		g.finish(key, c)
+	}()
+
+	func() {
+		defer func() {
+			if !normalReturn {
+				// runtime.Goexit 时 recover 返回 nil
+				if r := recover(); r != nil {
+					c.err = &PanicError{Value: r, Stack: debug.Stack()}
+				}
+			}
+		}()
+		c.val, c.err = fn()
+		normalReturn = true
+	}()
+	if !normalReturn {
+		recovered = true
+	}
+}
+
+// 在调用方重现 fn 的 panic 或 runtime.Goexit
+func rethrow(err error) error {
+	if pe, ok := err.(*PanicError); ok {
+		panic(pe)
+	}
+	if err == ErrGoexit {
+		runtime.Goexit()
+	}
+	return err
+}
+
+// 调用结束，之后的调用方会重新发起调用
+func (g *Group) finish(key string, c *Call) {
+	g.mu.Lock()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+	g.mu.Unlock()
+	close(c.done)
+}
 
-	return c.val, c.err
+// 调用方放弃等待，最后一个调用方离开时取消 fn
+func (g *Group) leave(key string, c *Call) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	c.waiters--
+	if c.waiters == 0 && c.cancel != nil {
+		c.cancel()
+		// 已取消的调用不再被新的调用方共享
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+	}
 }
@@ -0,0 +1,317 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	var g Group
+	v, err, _ := g.Do("key", func() (interface{}, error) {
+		return "bar", nil
+	})
+	if v != "bar" || err != nil {
+		t.Fatalf("Do = %v, %v", v, err)
+	}
+}
+
+// 测试一个调用方取消不影响共享同一次调用的其他调用方
+// 测试步骤
+//  1. 调用方 A 发起调用后取消，A 立即得到 context.Canceled
+//  2. 调用方 B 仍在等待，fn 的 context 没有被取消，B 得到正常结果
+//  3. fn 只执行一次
+func TestDoContextCancel(t *testing.T) {
+	var g Group
+	var calls atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		calls.Add(1)
+		close(started)
+		select {
+		case <-release:
+			return "bar", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	errA := make(chan error, 1)
+	go func() {
+		_, err, _ := g.DoContext(ctxA, "key", fn)
+		errA <- err
+	}()
+	<-started
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if v, err, _ := g.DoContext(context.Background(), "key", fn); v != "bar" || err != nil {
+			t.Errorf("B got %v, %v", v, err)
+		}
+	}()
+	// 等待 B 加入
+	time.Sleep(20 * time.Millisecond)
+	cancelA()
+	if err := <-errA; !errors.Is(err, context.Canceled) {
+		t.Fatalf("A got %v, want context.Canceled", err)
+	}
+	close(release)
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("fn called %d times, want 1", n)
+	}
+}
+
+// 测试所有调用方都放弃等待后 fn 的 context 被取消
+func TestDoContextAllLeave(t *testing.T) {
+	var g Group
+	cancelled := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err, _ := g.DoContext(ctx, "key", func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("fn should be cancelled after all callers left")
+	}
+}
+
+// 测试发起调用方的截止时间导致 fn 失败时，没有截止时间的调用方重新发起调用
+func TestDoContextDeadline(t *testing.T) {
+	var g Group
+	var calls atomic.Int32
+	started := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return "bar", nil
+	}
+
+	ctxA, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	errA := make(chan error, 1)
+	go func() {
+		_, err, _ := g.DoContext(ctxA, "key", fn)
+		errA <- err
+	}()
+	<-started
+	if v, err, _ := g.DoContext(context.Background(), "key", fn); v != "bar" || err != nil {
+		t.Fatalf("B got %v, %v", v, err)
+	}
+	if err := <-errA; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("A got %v, want context.DeadlineExceeded", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("fn called %d times, want 2", n)
+	}
+}
+
+// 测试并发调用共享同一次结果
+// 测试步骤
+//  1. 10 个 goroutine 同时调用 Do，fn 只执行一次
+//  2. 所有调用方得到相同的结果且 shared 为 true
+//  3. 单独调用时 shared 为 false
+func TestDoShared(t *testing.T) {
+	var g Group
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		calls.Add(1)
+		<-release
+		return "bar", nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err, shared := g.Do("key", fn); v != "bar" || err != nil || !shared {
+				t.Errorf("Do = %v, %v, %v", v, err, shared)
+			}
+		}()
+	}
+	waitWaiters(t, &g, "key", n)
+	close(release)
+	wg.Wait()
+	if c := calls.Load(); c != 1 {
+		t.Fatalf("fn called %d times, want 1", c)
+	}
+	if _, _, shared := g.Do("key", func() (interface{}, error) { return nil, nil }); shared {
+		t.Fatalf("a single caller should not be shared")
+	}
+}
+
+// 等待 key 的调用有 n 个调用方
+func waitWaiters(t *testing.T, g *Group, key string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		g.mu.Lock()
+		c, ok := g.calls[key]
+		done := ok && c.waiters == n
+		g.mu.Unlock()
+		if done {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d callers", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// 测试 DoChan 不阻塞并与 Do 共享结果
+func TestDoChan(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	ch := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return "bar", nil
+	})
+	waitWaiters(t, &g, "key", 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if v, err, shared := g.Do("key", func() (interface{}, error) { return "other", nil }); v != "bar" || err != nil || !shared {
+			t.Errorf("Do = %v, %v, %v", v, err, shared)
+		}
+	}()
+	waitWaiters(t, &g, "key", 2)
+	close(release)
+	if res := <-ch; res.Val != "bar" || res.Err != nil || !res.Shared {
+		t.Fatalf("DoChan = %+v", res)
+	}
+	<-done
+}
+
+// 测试 Forget 之后的调用重新执行 fn，已在等待的调用方仍得到原来的结果
+func TestForget(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	first := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return "first", nil
+	})
+	waitWaiters(t, &g, "key", 1)
+	g.Forget("key")
+	if v, _, shared := g.Do("key", func() (interface{}, error) { return "second", nil }); v != "second" || shared {
+		t.Fatalf("Do after Forget = %v, shared %v", v, shared)
+	}
+	close(release)
+	if res := <-first; res.Val != "first" {
+		t.Fatalf("forgotten call = %+v", res)
+	}
+}
+
+// 测试 fn panic 后所有调用方都得到 panic，之后的调用不受影响
+// 测试步骤
+//  1. Do 发起的 fn panic，发起方和等待方都以 *PanicError panic
+//  2. DoChan 的调用方在 Result.Err 中收到 *PanicError
+//  3. DoContext 的调用方同样以 *PanicError panic
+//  4. 调用结束后 key 被删除，新的调用正常执行
+func TestDoPanic(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		panic("boom")
+	}
+	// 调用 f 并返回其 panic 的值
+	catch := func(f func()) (r interface{}) {
+		defer func() { r = recover() }()
+		f()
+		return nil
+	}
+
+	panics := make(chan interface{}, 3)
+	for i := 0; i < 2; i++ {
+		go func() {
+			panics <- catch(func() { g.Do("key", fn) })
+		}()
+	}
+	go func() {
+		panics <- catch(func() {
+			g.DoContext(context.Background(), "key", func(context.Context) (interface{}, error) { return fn() })
+		})
+	}()
+	waitWaiters(t, &g, "key", 3)
+	ch := g.DoChan("key", fn)
+	waitWaiters(t, &g, "key", 4)
+	close(release)
+
+	for i := 0; i < 3; i++ {
+		pe, ok := (<-panics).(*PanicError)
+		if !ok || pe.Value != "boom" || len(pe.Stack) == 0 {
+			t.Fatalf("expect *PanicError, got %v", pe)
+		}
+	}
+	if res := <-ch; res.Err == nil {
+		t.Fatalf("DoChan should get the panic as an error")
+	} else if _, ok := res.Err.(*PanicError); !ok {
+		t.Fatalf("expect *PanicError, got %T", res.Err)
+	}
+	if v, err, _ := g.Do("key", func() (interface{}, error) { return "bar", nil }); v != "bar" || err != nil {
+		t.Fatalf("Do after panic = %v, %v", v, err)
+	}
+}
+
+// 测试 fn 调用 runtime.Goexit 后等待方的 goroutine 也退出，DoChan 的调用方收到 ErrGoexit
+func TestDoGoexit(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		runtime.Goexit()
+		return nil, nil
+	}
+
+	returned := make(chan bool, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			// Do 正常返回时为 true，goroutine 退出时只执行 defer
+			ok := false
+			defer func() { returned <- ok }()
+			g.Do("key", fn)
+			ok = true
+		}()
+	}
+	waitWaiters(t, &g, "key", 2)
+	ch := g.DoChan("key", fn)
+	waitWaiters(t, &g, "key", 3)
+	close(release)
+
+	for i := 0; i < 2; i++ {
+		if <-returned {
+			t.Fatalf("Do should not return after runtime.Goexit")
+		}
+	}
+	if res := <-ch; !errors.Is(res.Err, ErrGoexit) {
+		t.Fatalf("DoChan = %+v, want ErrGoexit", res)
+	}
+	if v, err, _ := g.Do("key", func() (interface{}, error) { return "bar", nil }); v != "bar" || err != nil {
+		t.Fatalf("Do after Goexit = %v, %v", v, err)
+	}
+}
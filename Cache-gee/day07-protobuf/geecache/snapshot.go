@@ -0,0 +1,167 @@
+package geecache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 快照文件格式：
+//
+//	magic(8 字节) | 缓存项数量(uvarint) | 缓存项... | CRC32(4 字节，大端)
+//
+// 每个缓存项为 key 长度(uvarint) | key | value 长度(uvarint) | value | 过期时间(varint，UnixNano，0 表示永不过期)，
+// 按淘汰顺序排列，最先被淘汰的在前。CRC32 覆盖之前的所有字节
+const snapshotMagic = "GEESNAP1"
+
+// ErrBadSnapshot 快照文件损坏或格式不正确，此时不会加载任何数据
+var ErrBadSnapshot = errors.New("geecache: bad snapshot")
+
+// SaveSnapshot 将 mainCache 中未过期的缓存项写入 w
+func (g *Group) SaveSnapshot(w io.Writer) error {
+	entries := g.mainCache.entries()
+	h := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, h))
+	var buf [binary.MaxVarintLen64]byte
+	putUvarint := func(v uint64) {
+		bw.Write(buf[:binary.PutUvarint(buf[:], v)])
+	}
+
+	bw.WriteString(snapshotMagic)
+	putUvarint(uint64(len(entries)))
+	for _, e := range entries {
+		putUvarint(uint64(len(e.key)))
+		bw.WriteString(e.key)
+		putUvarint(uint64(e.value.Len()))
+		bw.Write(e.value.b)
+		var expire int64
+		if !e.value.e.IsZero() {
+			expire = e.value.e.UnixNano()
+		}
+		bw.Write(buf[:binary.PutVarint(buf[:], expire)])
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	_, err := w.Write(binary.BigEndian.AppendUint32(nil, h.Sum32()))
+	return err
+}
+
+// LoadSnapshot 读取 SaveSnapshot 写入的快照并放入 mainCache，返回加载的缓存项数量。
+// 先校验整个快照再加载，快照损坏时返回 ErrBadSnapshot，已过期的缓存项会被跳过
+func (g *Group) LoadSnapshot(r io.Reader) (int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) < len(snapshotMagic)+crc32.Size || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return 0, fmt.Errorf("%w: missing header", ErrBadSnapshot)
+	}
+	body, sum := data[:len(data)-crc32.Size], data[len(data)-crc32.Size:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(sum) {
+		return 0, fmt.Errorf("%w: checksum mismatch", ErrBadSnapshot)
+	}
+
+	entries, err := decodeSnapshot(bytes.NewReader(body[len(snapshotMagic):]))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrBadSnapshot, err)
+	}
+	now := time.Now()
+	n := 0
+	for _, e := range entries {
+		if expire := e.value.e; !expire.IsZero() && !now.Before(expire) {
+			continue
+		}
+		g.populateCache(e.key, e.value)
+		n++
+	}
+	return n, nil
+}
+
+// 解析快照中的缓存项
+func decodeSnapshot(r *bytes.Reader) ([]cacheEntry, error) {
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	// 每个缓存项至少占 3 个字节，数量不可能超过剩余字节数
+	if count > uint64(r.Len()) {
+		return nil, fmt.Errorf("bad entry count %d", count)
+	}
+	readBytes := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		if n > uint64(r.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(r, b)
+		return b, err
+	}
+	entries := make([]cacheEntry, 0, count)
+	for i := uint64(0); i < count; i++ {
+		key, err := readBytes()
+		if err != nil {
+			return nil, err
+		}
+		value, err := readBytes()
+		if err != nil {
+			return nil, err
+		}
+		expire, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, err
+		}
+		e := cacheEntry{key: string(key), value: ByteView{b: value}}
+		if expire != 0 {
+			e.value.e = time.Unix(0, expire)
+		}
+		entries = append(entries, e)
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%d trailing bytes", r.Len())
+	}
+	return entries, nil
+}
+
+// SaveSnapshotFile 将快照写入文件。先写入同目录下的临时文件再重命名，
+// 写入过程中进程退出也不会留下不完整的快照
+func (g *Group) SaveSnapshotFile(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err = g.SaveSnapshot(f); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadSnapshotFile 从文件加载快照，文件不存在时返回 0 和 nil
+func (g *Group) LoadSnapshotFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return g.LoadSnapshot(f)
+}
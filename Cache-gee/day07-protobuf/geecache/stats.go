@@ -0,0 +1,74 @@
+package geecache
+
+import "sync/atomic"
+
+// Stats 缓存组的统计信息
+type Stats struct {
+	// Get 请求次数，包括来自远程节点的请求
+	Gets int64
+	// mainCache、hotCache 或磁盘缓存命中次数
+	Hits int64
+	// 命中已过软有效期的旧值、触发后台刷新的次数，也计入 Hits
+	StaleHits int64
+	// 内存未命中、从磁盘缓存取回的次数，也计入 Hits
+	DiskHits int64
+	// 未命中本地缓存的次数
+	Misses int64
+	// 命中不存在的 key 的记录、直接返回 ErrNotFound 的次数
+	NegativeHits int64
+	// 从远程节点成功获取的次数
+	PeerLoads int64
+	// 从远程节点获取失败的次数
+	PeerErrors int64
+	// 调用回调函数从数据源成功加载的次数
+	LocalLoads int64
+	// 调用回调函数从数据源加载失败的次数
+	LocalLoadErrs int64
+	// 与其他请求合并、未实际加载的次数
+	Dedups int64
+	// mainCache 和 hotCache 因容量不足或过期淘汰的缓存项数
+	Evictions int64
+	// mainCache 和 hotCache 占用的字节数
+	Bytes int64
+	// mainCache 和 hotCache 中的缓存项数
+	Items int64
+}
+
+// 缓存组的原子计数器，可以被多个 goroutine 并发更新
+type groupStats struct {
+	gets          atomic.Int64
+	hits          atomic.Int64
+	staleHits     atomic.Int64
+	diskHits      atomic.Int64
+	misses        atomic.Int64
+	negativeHits  atomic.Int64
+	peerLoads     atomic.Int64
+	peerErrors    atomic.Int64
+	localLoads    atomic.Int64
+	localLoadErrs atomic.Int64
+	dedups        atomic.Int64
+}
+
+// Stats 返回缓存组统计信息的快照
+func (g *Group) Stats() Stats {
+	s := Stats{
+		Gets:          g.stats.gets.Load(),
+		Hits:          g.stats.hits.Load(),
+		StaleHits:     g.stats.staleHits.Load(),
+		DiskHits:      g.stats.diskHits.Load(),
+		Misses:        g.stats.misses.Load(),
+		NegativeHits:  g.stats.negativeHits.Load(),
+		PeerLoads:     g.stats.peerLoads.Load(),
+		PeerErrors:    g.stats.peerErrors.Load(),
+		LocalLoads:    g.stats.localLoads.Load(),
+		LocalLoadErrs: g.stats.localLoadErrs.Load(),
+		Dedups:        g.stats.dedups.Load(),
+	}
+	for _, c := range []CacheType{MainCache, HotCache} {
+		cs := g.CacheStats(c)
+		s.Evictions += cs.Evictions
+		s.Bytes += cs.Bytes
+		s.Items += cs.Items
+	}
+	return s
+}
@@ -0,0 +1,132 @@
+package geecache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	pb "geecache/geecachepb"
+	"hash/crc32"
+	"io"
+	"slices"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// 较大的缓存值分块传输，响应体格式：
+//
+//	uvarint(len(header)) header uvarint(len(value)) chunk...
+//	chunk = uvarint(n) data[n] crc32(data)
+//
+// header 是不含 Value 的 proto 编码的 Response，crc32 为大端序的 IEEE 校验和。
+// 请求方先读到总长度并检查大小，预先分配的内存不超过 maxStreamPrealloc，
+// 之后随着数据到达再扩容，声明的总长度不可信时也不会一次分配过多内存
+const (
+	streamContentType = "application/x-geecache-stream"
+	// 每块的大小
+	streamChunkSize = 256 << 10
+	// header 的最大长度，Response 中除 Value 外只有几个整数
+	maxStreamHeader = 1 << 10
+	// 按声明的总长度预先分配的最大字节数
+	maxStreamPrealloc = 4 * streamChunkSize
+)
+
+// ErrChecksum 分块传输的缓存值校验失败
+var ErrChecksum = errors.New("geecache: chunk checksum mismatch")
+
+// 将 res 分块写入 w，value 不会被复制
+func writeStream(w io.Writer, res *pb.Response, value []byte) error {
+	header, err := proto.Marshal(res)
+	if err != nil {
+		return err
+	}
+	var buf [binary.MaxVarintLen64 + 4]byte
+	writeUvarint := func(v uint64) error {
+		_, err := w.Write(binary.AppendUvarint(buf[:0], v))
+		return err
+	}
+	if err := writeUvarint(uint64(len(header))); err != nil {
+		return err
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if err := writeUvarint(uint64(len(value))); err != nil {
+		return err
+	}
+	for len(value) > 0 {
+		chunk := value[:min(len(value), streamChunkSize)]
+		value = value[len(chunk):]
+		if err := writeUvarint(uint64(len(chunk))); err != nil {
+			return err
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+		if _, err := w.Write(binary.BigEndian.AppendUint32(buf[:0], crc32.ChecksumIEEE(chunk))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 读取 writeStream 写入的响应，limit 大于 0 时超过 limit 字节的缓存值返回 ErrValueTooLarge。
+// 数据被截断时返回 io.ErrUnexpectedEOF，校验失败时返回 ErrChecksum
+func readStream(r io.Reader, out *pb.Response, limit int64) error {
+	br := bufio.NewReader(r)
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if n > maxStreamHeader {
+		return fmt.Errorf("stream header too large: %d bytes", n)
+	}
+	header := make([]byte, n)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return unexpectedEOF(err)
+	}
+	if err := proto.Unmarshal(header, out); err != nil {
+		return fmt.Errorf("decoding stream header: %v", err)
+	}
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if limit > 0 && size > uint64(limit) {
+		return fmt.Errorf("%w: %d bytes", ErrValueTooLarge, size)
+	}
+	value := make([]byte, 0, min(size, maxStreamPrealloc))
+	var sum [4]byte
+	for off := uint64(0); off < size; {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		if n == 0 || n > size-off || n > streamChunkSize {
+			return fmt.Errorf("bad chunk length %d at offset %d", n, off)
+		}
+		value = slices.Grow(value, int(n))
+		chunk := value[off : off+n]
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return unexpectedEOF(err)
+		}
+		if _, err := io.ReadFull(br, sum[:]); err != nil {
+			return unexpectedEOF(err)
+		}
+		if binary.BigEndian.Uint32(sum[:]) != crc32.ChecksumIEEE(chunk) {
+			return fmt.Errorf("%w at offset %d", ErrChecksum, off)
+		}
+		value = value[:off+n]
+		off += n
+	}
+	out.Value = value
+	return nil
+}
+
+// 读到一半遇到 EOF 说明数据被截断
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
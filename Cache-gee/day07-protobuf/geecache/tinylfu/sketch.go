@@ -0,0 +1,80 @@
+package tinylfu
+
+import "hash/fnv"
+
+const (
+	// Count-Min Sketch 的行数
+	sketchDepth = 4
+	// 计数器上限，相当于 4 位计数器
+	maxCount = 15
+)
+
+// sketch Count-Min Sketch，用很小的内存近似统计每个 key 的访问频率。
+// 累计记录次数达到 sampleSize 后所有计数器减半，使频率随时间衰减，
+// 过去的热点数据不会永远占据缓存。
+type sketch struct {
+	rows       [sketchDepth][]uint8
+	mask       uint32
+	additions  int
+	sampleSize int
+}
+
+func newSketch(width int) *sketch {
+	// 宽度取 2 的幂，方便用位运算取下标
+	w := 1
+	for w < width {
+		w <<= 1
+	}
+	s := &sketch{mask: uint32(w - 1), sampleSize: 10 * w}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, w)
+	}
+	return s
+}
+
+// 由一次 64 位哈希派生出每一行的下标
+func (s *sketch) indexes(key string) [sketchDepth]uint32 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := uint32(sum), uint32(sum>>32)
+	var idx [sketchDepth]uint32
+	for i := range idx {
+		idx[i] = (h1 + uint32(i)*h2) & s.mask
+	}
+	return idx
+}
+
+// 记录一次访问
+func (s *sketch) increment(key string) {
+	for i, j := range s.indexes(key) {
+		if s.rows[i][j] < maxCount {
+			s.rows[i][j]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+// 估算访问频率，取各行计数的最小值
+func (s *sketch) estimate(key string) uint8 {
+	min := uint8(maxCount)
+	for i, j := range s.indexes(key) {
+		if s.rows[i][j] < min {
+			min = s.rows[i][j]
+		}
+	}
+	return min
+}
+
+// 所有计数器减半
+func (s *sketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
@@ -0,0 +1,266 @@
+package tinylfu
+
+import (
+	"container/list"
+	"geecache/lru"
+	"time"
+)
+
+const (
+	// 窗口 LRU 占总容量的比例
+	defaultWindowRatio = 0.01
+	// 主缓存中保护区的比例
+	defaultProtectedRatio = 0.8
+	// 不限容量时频率统计的宽度
+	defaultSketchWidth = 1 << 16
+)
+
+// Cache W-TinyLFU 缓存，按字节数计算容量。
+// 新数据先进入很小的窗口 LRU，从窗口淘汰的候选项要与主缓存(分段 LRU)
+// 的淘汰对象比较访问频率，频率更高才能进入主缓存。
+// 主缓存分为试用区和保护区，试用区中再次被访问的缓存项晋升到保护区。
+type Cache struct {
+	maxBytes int64
+	// 窗口和保护区的字节上限
+	maxWindow, maxProtected int64
+
+	window, probation, protected                *list.List
+	windowBytes, probationBytes, protectedBytes int64
+
+	items  map[string]*list.Element
+	sketch *sketch
+	// 与 lru.Cache 相同的淘汰回调
+	OnEvicted func(key string, value lru.Value, reason lru.EvictReason)
+}
+
+type entry struct {
+	key    string
+	value  lru.Value
+	expire time.Time
+	// 占用的字节数
+	size int64
+	// 所在的区域
+	in *list.List
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
+}
+
+func New(maxBytes int64, onEvicted func(string, lru.Value, lru.EvictReason)) *Cache {
+	width := defaultSketchWidth
+	if maxBytes > 0 {
+		// 假设平均每个缓存项占 16 字节来估算频率统计的宽度，宽度过小时哈希冲突会抬高冷数据的频率
+		width = int(min(max(maxBytes/16, 1<<12), 1<<20))
+	}
+	c := &Cache{
+		window:    list.New(),
+		probation: list.New(),
+		protected: list.New(),
+		items:     make(map[string]*list.Element),
+		sketch:    newSketch(width),
+		OnEvicted: onEvicted,
+	}
+	c.setLimits(maxBytes)
+	return c
+}
+
+// 按最大字节数计算窗口和保护区的上限
+func (c *Cache) setLimits(maxBytes int64) {
+	c.maxBytes = maxBytes
+	c.maxWindow = int64(float64(maxBytes) * defaultWindowRatio)
+	c.maxProtected = int64(float64(maxBytes-c.maxWindow) * defaultProtectedRatio)
+}
+
+// SetMaxBytes 修改最大字节数，超出新上限时通过 RemoveOldest 淘汰缓存项。
+// 频率统计的宽度保持创建时的大小
+func (c *Cache) SetMaxBytes(maxBytes int64) {
+	c.setLimits(maxBytes)
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.maxBytes < c.Bytes() {
+		c.RemoveOldest()
+	}
+}
+
+// 返回区域对应的字节计数
+func (c *Cache) bytesOf(l *list.List) *int64 {
+	switch l {
+	case c.window:
+		return &c.windowBytes
+	case c.probation:
+		return &c.probationBytes
+	}
+	return &c.protectedBytes
+}
+
+func (c *Cache) pushTo(e *entry, to *list.List) {
+	e.in = to
+	*c.bytesOf(to) += e.size
+	c.items[e.key] = to.PushFront(e)
+}
+
+func (c *Cache) unlink(ele *list.Element) *entry {
+	e := ele.Value.(*entry)
+	e.in.Remove(ele)
+	*c.bytesOf(e.in) -= e.size
+	return e
+}
+
+func (c *Cache) Get(key string) (value lru.Value, ok bool) {
+	c.sketch.increment(key)
+	if ele, ok := c.items[key]; ok {
+		e := ele.Value.(*entry)
+		if e.expired(time.Now()) {
+			c.removeItem(ele, lru.EvictExpired)
+			return nil, false
+		}
+		c.hit(ele)
+		return e.value, true
+	}
+	return
+}
+
+// Peek 返回缓存值，不计入访问频率也不调整位置，已过期的缓存项视为不存在但不会被删除
+func (c *Cache) Peek(key string) (value lru.Value, ok bool) {
+	if ele, ok := c.items[key]; ok {
+		if e := ele.Value.(*entry); !e.expired(time.Now()) {
+			return e.value, true
+		}
+	}
+	return
+}
+
+// 命中后调整位置，试用区的缓存项晋升到保护区，保护区超出上限时降级到试用区
+func (c *Cache) hit(ele *list.Element) {
+	e := ele.Value.(*entry)
+	if e.in != c.probation {
+		e.in.MoveToFront(ele)
+		return
+	}
+	c.unlink(ele)
+	c.pushTo(e, c.protected)
+	for c.protected.Len() > 1 && c.protectedBytes > c.maxProtected {
+		demoted := c.unlink(c.protected.Back())
+		c.pushTo(demoted, c.probation)
+	}
+}
+
+func (c *Cache) Add(key string, value lru.Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire 添加缓存项并指定过期时间，expire 为零值表示永不过期
+func (c *Cache) AddWithExpire(key string, value lru.Value, expire time.Time) {
+	size := int64(len(key) + value.Len())
+	if ele, ok := c.items[key]; ok {
+		e := ele.Value.(*entry)
+		*c.bytesOf(e.in) += size - e.size
+		e.value, e.expire, e.size = value, expire, size
+		c.hit(ele)
+	} else {
+		c.pushTo(&entry{key: key, value: value, expire: expire, size: size}, c.window)
+	}
+	if c.maxBytes == 0 {
+		return
+	}
+	c.evictWindow()
+	for c.maxBytes < c.Bytes() {
+		c.RemoveOldest()
+	}
+}
+
+// 窗口超出上限时，窗口中最久未使用的缓存项作为候选项尝试进入主缓存
+func (c *Cache) evictWindow() {
+	maxMain := c.maxBytes - c.maxWindow
+	for c.window.Len() > 0 && c.windowBytes > c.maxWindow {
+		candidate := c.unlink(c.window.Back())
+		delete(c.items, candidate.key)
+		for candidate != nil && c.probationBytes+c.protectedBytes+candidate.size > maxMain {
+			victim := c.probation.Back()
+			if victim == nil {
+				victim = c.protected.Back()
+			}
+			if victim == nil {
+				break
+			}
+			// 候选项的访问频率高于淘汰对象才允许进入主缓存
+			if c.sketch.estimate(candidate.key) > c.sketch.estimate(victim.Value.(*entry).key) {
+				c.removeItem(victim, lru.EvictCapacity)
+			} else {
+				if c.OnEvicted != nil {
+					c.OnEvicted(candidate.key, candidate.value, lru.EvictCapacity)
+				}
+				candidate = nil
+			}
+		}
+		if candidate != nil {
+			c.pushTo(candidate, c.probation)
+		}
+	}
+}
+
+// RemoveOldest 依次从试用区、保护区、窗口中淘汰最久未使用的缓存项
+func (c *Cache) RemoveOldest() {
+	for _, l := range []*list.List{c.probation, c.protected, c.window} {
+		if ele := l.Back(); ele != nil {
+			c.removeItem(ele, lru.EvictCapacity)
+			return
+		}
+	}
+}
+
+func (c *Cache) removeItem(ele *list.Element, reason lru.EvictReason) {
+	e := c.unlink(ele)
+	delete(c.items, e.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value, reason)
+	}
+}
+
+// Remove 主动删除缓存项
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.items[key]; ok {
+		c.removeItem(ele, lru.EvictRemoved)
+	}
+}
+
+// RemoveExpired 删除所有已过期的缓存项，返回删除的数量
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	n := 0
+	for _, l := range []*list.List{c.window, c.probation, c.protected} {
+		for ele := l.Back(); ele != nil; {
+			prev := ele.Prev()
+			if ele.Value.(*entry).expired(now) {
+				c.removeItem(ele, lru.EvictExpired)
+				n++
+			}
+			ele = prev
+		}
+	}
+	return n
+}
+
+// Range 依次遍历试用区、保护区和窗口，每个区域从旧到新，fn 返回 false 时停止遍历。
+// 窗口放在最后，重新添加时最近的数据仍在窗口中
+func (c *Cache) Range(fn func(key string, value lru.Value, expire time.Time) bool) {
+	for _, l := range []*list.List{c.probation, c.protected, c.window} {
+		for ele := l.Back(); ele != nil; ele = ele.Prev() {
+			e := ele.Value.(*entry)
+			if !fn(e.key, e.value, e.expire) {
+				return
+			}
+		}
+	}
+}
+
+func (c *Cache) Len() int {
+	return len(c.items)
+}
+
+// Bytes 返回当前已使用的字节数
+func (c *Cache) Bytes() int64 {
+	return c.windowBytes + c.probationBytes + c.protectedBytes
+}
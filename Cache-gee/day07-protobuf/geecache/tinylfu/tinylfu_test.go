@@ -0,0 +1,82 @@
+package tinylfu
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	c := New(int64(10), nil)
+	c.Add("key1", String("1234"))
+	if v, ok := c.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := c.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestAdmission(t *testing.T) {
+	// 测试逻辑
+	// 测试步骤：
+	// 1. 设置缓存容量能缓存约100个缓存项，反复访问h0~h49使其频率升高
+	// 2. 顺序扫描500个只访问一次的key
+	// 3. 扫描数据频率低，无法进入主缓存，h0~h49仍然命中
+	c := New(int64(100*8), nil)
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 50; i++ {
+			key := fmt.Sprintf("h%04d", i)
+			if _, ok := c.Get(key); !ok {
+				c.Add(key, String("v1"))
+			}
+		}
+	}
+	for i := 0; i < 500; i++ {
+		key := fmt.Sprintf("s%04d", i)
+		if _, ok := c.Get(key); !ok {
+			c.Add(key, String("v1"))
+		}
+	}
+	for i := 0; i < 50; i++ {
+		if _, ok := c.Get(fmt.Sprintf("h%04d", i)); !ok {
+			t.Fatalf("hot key h%04d flushed by scan", i)
+		}
+	}
+	if c.Bytes() > 800 {
+		t.Fatalf("cache exceeds maxBytes: %d", c.Bytes())
+	}
+}
+
+func TestSketch(t *testing.T) {
+	s := newSketch(16)
+	for i := 0; i < 5; i++ {
+		s.increment("hot")
+	}
+	if s.estimate("hot") != 5 {
+		t.Fatalf("expect frequency 5, got %d", s.estimate("hot"))
+	}
+	s.reset()
+	if s.estimate("hot") != 2 {
+		t.Fatalf("expect frequency halved to 2, got %d", s.estimate("hot"))
+	}
+}
+
+func TestExpire(t *testing.T) {
+	c := New(int64(0), nil)
+	c.AddWithExpire("k1", String("v1"), time.Now().Add(-time.Second))
+	c.Add("k2", String("v2"))
+	if _, ok := c.Get("k1"); ok {
+		t.Fatalf("expired k1 should miss")
+	}
+	c.AddWithExpire("k3", String("v3"), time.Now().Add(-time.Second))
+	if n := c.RemoveExpired(); n != 1 || c.Len() != 1 || c.Bytes() != 4 {
+		t.Fatalf("RemoveExpired failed, removed %d, left %d", n, c.Len())
+	}
+}
@@ -0,0 +1,241 @@
+package twoq
+
+import (
+	"container/list"
+	"geecache/lru"
+	"time"
+)
+
+const (
+	// a1in 占总容量的比例
+	defaultRecentRatio = 0.25
+	// a1out 幽灵项占总容量的比例，幽灵项只保存 key，按 key 的长度计算字节数
+	defaultGhostRatio = 0.5
+)
+
+// Cache 2Q 缓存，按字节数计算容量。
+// 新数据先进入先进先出队列 a1in，从 a1in 淘汰的 key 记录在幽灵队列 a1out 中，
+// 只有在 a1out 中再次被访问的数据才会进入 LRU 队列 am。
+// 只访问一次的扫描数据停留在 a1in 中，不会冲刷 am 中的热点数据。
+type Cache struct {
+	maxBytes int64
+	// a1in、a1out 的字节上限
+	recentBytes, ghostBytes int64
+
+	a1in, a1out, am                *list.List
+	a1inBytes, a1outBytes, amBytes int64
+
+	// a1in、am 中的缓存项
+	items map[string]*list.Element
+	// a1out 中的幽灵项
+	ghosts map[string]*list.Element
+	// 与 lru.Cache 相同的淘汰回调
+	OnEvicted func(key string, value lru.Value, reason lru.EvictReason)
+}
+
+type entry struct {
+	key    string
+	value  lru.Value
+	expire time.Time
+	// 占用的字节数
+	size int64
+	// 所在的队列
+	in *list.List
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
+}
+
+func New(maxBytes int64, onEvicted func(string, lru.Value, lru.EvictReason)) *Cache {
+	c := &Cache{
+		a1in:      list.New(),
+		a1out:     list.New(),
+		am:        list.New(),
+		items:     make(map[string]*list.Element),
+		ghosts:    make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+	c.setLimits(maxBytes)
+	return c
+}
+
+// 按最大字节数计算 a1in、a1out 的上限
+func (c *Cache) setLimits(maxBytes int64) {
+	c.maxBytes = maxBytes
+	c.recentBytes = int64(float64(maxBytes) * defaultRecentRatio)
+	c.ghostBytes = int64(float64(maxBytes) * defaultGhostRatio)
+}
+
+// SetMaxBytes 修改最大字节数，超出新上限时通过 RemoveOldest 淘汰缓存项
+func (c *Cache) SetMaxBytes(maxBytes int64) {
+	c.setLimits(maxBytes)
+	for c.maxBytes != 0 && c.maxBytes < c.a1inBytes+c.amBytes {
+		c.RemoveOldest()
+	}
+	for c.a1out.Len() > 0 && c.a1outBytes > c.ghostBytes {
+		g := c.unlink(c.a1out.Back())
+		delete(c.ghosts, g.key)
+	}
+}
+
+// 返回队列对应的字节计数
+func (c *Cache) bytesOf(l *list.List) *int64 {
+	switch l {
+	case c.a1in:
+		return &c.a1inBytes
+	case c.a1out:
+		return &c.a1outBytes
+	}
+	return &c.amBytes
+}
+
+func (c *Cache) pushTo(e *entry, to *list.List) *list.Element {
+	e.in = to
+	*c.bytesOf(to) += e.size
+	return to.PushFront(e)
+}
+
+func (c *Cache) unlink(ele *list.Element) *entry {
+	e := ele.Value.(*entry)
+	e.in.Remove(ele)
+	*c.bytesOf(e.in) -= e.size
+	return e
+}
+
+func (c *Cache) Get(key string) (value lru.Value, ok bool) {
+	if ele, ok := c.items[key]; ok {
+		e := ele.Value.(*entry)
+		if e.expired(time.Now()) {
+			c.removeItem(ele, lru.EvictExpired)
+			return nil, false
+		}
+		// a1in 是先进先出队列，命中时不调整位置
+		if e.in == c.am {
+			c.am.MoveToFront(ele)
+		}
+		return e.value, true
+	}
+	return
+}
+
+// Peek 返回缓存值但不调整位置，已过期的缓存项视为不存在但不会被删除
+func (c *Cache) Peek(key string) (value lru.Value, ok bool) {
+	if ele, ok := c.items[key]; ok {
+		if e := ele.Value.(*entry); !e.expired(time.Now()) {
+			return e.value, true
+		}
+	}
+	return
+}
+
+func (c *Cache) Add(key string, value lru.Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire 添加缓存项并指定过期时间，expire 为零值表示永不过期
+func (c *Cache) AddWithExpire(key string, value lru.Value, expire time.Time) {
+	size := int64(len(key) + value.Len())
+	if ele, ok := c.items[key]; ok {
+		e := ele.Value.(*entry)
+		*c.bytesOf(e.in) += size - e.size
+		e.value, e.expire, e.size = value, expire, size
+		if e.in == c.am {
+			c.am.MoveToFront(ele)
+		}
+	} else {
+		e := &entry{key: key, value: value, expire: expire, size: size}
+		if ghost, ok := c.ghosts[key]; ok {
+			// 近期被淘汰过又再次访问，说明是热点数据，直接进入 am
+			c.unlink(ghost)
+			delete(c.ghosts, key)
+			c.items[key] = c.pushTo(e, c.am)
+		} else {
+			c.items[key] = c.pushTo(e, c.a1in)
+		}
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.a1inBytes+c.amBytes {
+		c.RemoveOldest()
+	}
+}
+
+// RemoveOldest a1in 超出上限时淘汰其最早进入的缓存项并记入 a1out，
+// 否则淘汰 am 中最久未使用的缓存项
+func (c *Cache) RemoveOldest() {
+	if c.a1in.Len() > 0 && (c.a1inBytes > c.recentBytes || c.am.Len() == 0) {
+		e := c.unlink(c.a1in.Back())
+		delete(c.items, e.key)
+		// 幽灵项不保存缓存值，只按 key 计算字节数，使 a1out 能记住足够多的 key，不会被一次扫描冲掉
+		value := e.value
+		e.value, e.size = nil, int64(len(e.key))
+		c.ghosts[e.key] = c.pushTo(e, c.a1out)
+		for c.a1out.Len() > 0 && c.a1outBytes > c.ghostBytes {
+			g := c.unlink(c.a1out.Back())
+			delete(c.ghosts, g.key)
+		}
+		if c.OnEvicted != nil {
+			c.OnEvicted(e.key, value, lru.EvictCapacity)
+		}
+		return
+	}
+	if ele := c.am.Back(); ele != nil {
+		c.removeItem(ele, lru.EvictCapacity)
+	}
+}
+
+func (c *Cache) removeItem(ele *list.Element, reason lru.EvictReason) {
+	e := c.unlink(ele)
+	delete(c.items, e.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value, reason)
+	}
+}
+
+// Remove 主动删除缓存项
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.items[key]; ok {
+		c.removeItem(ele, lru.EvictRemoved)
+	}
+	if ghost, ok := c.ghosts[key]; ok {
+		c.unlink(ghost)
+		delete(c.ghosts, key)
+	}
+}
+
+// RemoveExpired 删除所有已过期的缓存项，返回删除的数量
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	n := 0
+	for _, l := range []*list.List{c.a1in, c.am} {
+		for ele := l.Back(); ele != nil; {
+			prev := ele.Prev()
+			if ele.Value.(*entry).expired(now) {
+				c.removeItem(ele, lru.EvictExpired)
+				n++
+			}
+			ele = prev
+		}
+	}
+	return n
+}
+
+// Range 先遍历 a1in 再遍历 am，每个队列从旧到新，fn 返回 false 时停止遍历
+func (c *Cache) Range(fn func(key string, value lru.Value, expire time.Time) bool) {
+	for _, l := range []*list.List{c.a1in, c.am} {
+		for ele := l.Back(); ele != nil; ele = ele.Prev() {
+			e := ele.Value.(*entry)
+			if !fn(e.key, e.value, e.expire) {
+				return
+			}
+		}
+	}
+}
+
+func (c *Cache) Len() int {
+	return c.a1in.Len() + c.am.Len()
+}
+
+// Bytes 返回当前已使用的字节数
+func (c *Cache) Bytes() int64 {
+	return c.a1inBytes + c.amBytes
+}
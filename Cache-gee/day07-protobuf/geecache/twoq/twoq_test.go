@@ -0,0 +1,68 @@
+package twoq
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	q := New(int64(10), nil)
+	q.Add("key1", String("1234"))
+	if v, ok := q.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := q.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestPromote(t *testing.T) {
+	// 测试逻辑
+	// 测试步骤：
+	// 1. 设置缓存容量只能缓存10个缓存项，添加k0~k10，k0被淘汰进入幽灵队列a1out，只按key计算字节数
+	// 2. 再次添加k0，k0进入am
+	// 3. 顺序扫描20个只访问一次的key，扫描数据只在a1in中淘汰，k0仍然命中
+	q := New(int64(10*4), nil)
+	for i := 0; i <= 10; i++ {
+		q.Add(fmt.Sprintf("k%d", i), String("v1"))
+	}
+	if _, ok := q.ghosts["k0"]; !ok {
+		t.Fatalf("k0 should be recorded in a1out")
+	}
+	if q.a1outBytes != int64(len("k0")*q.a1out.Len()) {
+		t.Fatalf("ghost should only count its key, a1out bytes %d", q.a1outBytes)
+	}
+	q.Add("k0", String("v1"))
+	if q.am.Len() != 1 {
+		t.Fatalf("k0 should be promoted to am")
+	}
+	for i := 0; i < 20; i++ {
+		q.Add(fmt.Sprintf("s%d", i), String("v1"))
+	}
+	if _, ok := q.Get("k0"); !ok {
+		t.Fatalf("k0 in am flushed by scan")
+	}
+	if q.Bytes() > 40 {
+		t.Fatalf("cache exceeds maxBytes: %d", q.Bytes())
+	}
+}
+
+func TestExpire(t *testing.T) {
+	q := New(int64(0), nil)
+	q.AddWithExpire("k1", String("v1"), time.Now().Add(-time.Second))
+	q.Add("k2", String("v2"))
+	if _, ok := q.Get("k1"); ok {
+		t.Fatalf("expired k1 should miss")
+	}
+	q.AddWithExpire("k3", String("v3"), time.Now().Add(-time.Second))
+	if n := q.RemoveExpired(); n != 1 || q.Len() != 1 || q.Bytes() != 4 {
+		t.Fatalf("RemoveExpired failed, removed %d, left %d", n, q.Len())
+	}
+}
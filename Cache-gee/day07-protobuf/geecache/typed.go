@@ -0,0 +1,167 @@
+package geecache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"geecache/lru"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec 在类型 T 和缓存值之间转换
+type Codec[T any] interface {
+	Marshal(v T) ([]byte, error)
+	Unmarshal(data []byte) (T, error)
+}
+
+// JSONCodec 使用 encoding/json 编码
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Marshal(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec[T]) Unmarshal(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// GobCodec 使用 encoding/gob 编码，T 中的接口类型字段需要先用 gob.Register 注册
+type GobCodec[T any] struct{}
+
+func (GobCodec[T]) Marshal(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec[T]) Unmarshal(data []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+// ProtoCodec 使用 protobuf 编码，T 是生成的消息的指针类型，例如 *pb.Response
+type ProtoCodec[T proto.Message] struct{}
+
+func (ProtoCodec[T]) Marshal(v T) ([]byte, error) {
+	return proto.Marshal(v)
+}
+
+func (ProtoCodec[T]) Unmarshal(data []byte) (T, error) {
+	var zero T
+	// 生成的消息类型的 nil 指针也可以调用 ProtoReflect
+	v := zero.ProtoReflect().New().Interface().(T)
+	err := proto.Unmarshal(data, v)
+	return v, err
+}
+
+// 解码后的值默认最多占 mainCache 容量的 1/4，按编码后的长度计算，mainCache 有上限时至少 1 字节
+const defaultDecodedCacheRatio = 4
+
+// TypedGroup 在 Group 的基础上用 Codec 存取类型为 T 的值。
+// 解码后的值按 key 缓存，缓存值没有变化时直接返回上次解码的结果，
+// 因此返回的值在多次调用之间共享，T 是指针、切片或 map 时调用方不能修改它
+type TypedGroup[T any] struct {
+	group *Group
+	codec Codec[T]
+
+	mu sync.Mutex
+	// 解码后的值，与 Group 中的缓存值一一对应
+	decoded *lru.Cache
+}
+
+// 解码后的值和解码时的缓存值，缓存值是同一个切片时说明没有变化
+type decodedEntry[T any] struct {
+	b []byte
+	v T
+}
+
+func (e *decodedEntry[T]) Len() int {
+	return len(e.b)
+}
+
+// NewTypedGroup 创建类型为 T 的缓存组，loader 从数据源加载 key 对应的值，
+// 返回包装了 ErrNotFound 的错误时与 Getter 一样会被缓存。opts 与 NewGroup 相同
+func NewTypedGroup[T any](name string, cacheBytes int64, codec Codec[T],
+	loader func(ctx context.Context, key string) (T, error), opts ...GroupOption) *TypedGroup[T] {
+	if loader == nil {
+		panic("nil loader")
+	}
+	getter := ContextGetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		v, err := loader(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return codec.Marshal(v)
+	})
+	return &TypedGroup[T]{
+		group:   NewGroup(name, cacheBytes, getter, opts...),
+		codec:   codec,
+		decoded: lru.New(fractionBytes(cacheBytes, defaultDecodedCacheRatio), nil),
+	}
+}
+
+// Group 返回底层的缓存组
+func (t *TypedGroup[T]) Group() *Group {
+	return t.group
+}
+
+func (t *TypedGroup[T]) Get(key string) (T, error) {
+	return t.GetContext(context.Background(), key)
+}
+
+// GetContext 获取 key 对应的值，缓存值与上次解码时相同时不会再次解码
+func (t *TypedGroup[T]) GetContext(ctx context.Context, key string) (T, error) {
+	var zero T
+	view, err := t.group.GetContext(ctx, key)
+	if err != nil {
+		return zero, err
+	}
+	t.mu.Lock()
+	if e, ok := t.decoded.Get(key); ok {
+		if e := e.(*decodedEntry[T]); sameBytes(e.b, view.b) {
+			t.mu.Unlock()
+			return e.v, nil
+		}
+	}
+	t.mu.Unlock()
+
+	v, err := t.codec.Unmarshal(view.b)
+	if err != nil {
+		return zero, fmt.Errorf("%s: decoding value: %w", key, err)
+	}
+	t.mu.Lock()
+	t.decoded.Add(key, &decodedEntry[T]{b: view.b, v: v})
+	t.mu.Unlock()
+	return v, nil
+}
+
+// Set 编码后写入缓存值，与 Group.Set 相同
+func (t *TypedGroup[T]) Set(key string, v T) error {
+	b, err := t.codec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("%s: encoding value: %w", key, err)
+	}
+	return t.group.Set(key, b)
+}
+
+// Remove 删除缓存值，与 Group.Remove 相同
+func (t *TypedGroup[T]) Remove(key string) error {
+	t.mu.Lock()
+	t.decoded.Remove(key)
+	t.mu.Unlock()
+	return t.group.Remove(key)
+}
+
+// 两个切片是否共用同一段内存，缓存值被替换后底层数组一定不同
+func sameBytes(a, b []byte) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
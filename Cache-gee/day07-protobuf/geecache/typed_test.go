@@ -0,0 +1,80 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "geecache/geecachepb"
+	"sync/atomic"
+	"testing"
+)
+
+type player struct {
+	Name  string
+	Score int
+}
+
+// 记录解码次数的 Codec
+type countingCodec[T any] struct {
+	Codec[T]
+	decodes atomic.Int32
+}
+
+func (c *countingCodec[T]) Unmarshal(data []byte) (T, error) {
+	c.decodes.Add(1)
+	return c.Codec.Unmarshal(data)
+}
+
+// 测试 TypedGroup
+// 测试步骤
+//  1. JSON、gob 和 protobuf 三种 Codec 都能取回 loader 返回的值
+//  2. 缓存值没有变化时不会重复解码，Set 写入新值后重新解码
+//  3. loader 返回的 ErrNotFound 原样返回
+func TestTypedGroup(t *testing.T) {
+	loader := func(ctx context.Context, key string) (player, error) {
+		if key == "missing" {
+			return player{}, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return player{Name: key, Score: len(key) * 100}, nil
+	}
+	for name, codec := range map[string]Codec[player]{"json": JSONCodec[player]{}, "gob": GobCodec[player]{}} {
+		counting := &countingCodec[player]{Codec: codec}
+		g := NewTypedGroup[player]("typed-"+name, 2<<10, counting, loader)
+		for i := 0; i < 3; i++ {
+			if p, err := g.Get("Tom"); err != nil || p != (player{"Tom", 300}) {
+				t.Fatalf("%s: Get(Tom) = %v, %v", name, p, err)
+			}
+		}
+		if n := counting.decodes.Load(); n != 1 {
+			t.Fatalf("%s: expect 1 decode for repeated hits, got %d", name, n)
+		}
+		if err := g.Set("Tom", player{"Tom", 999}); err != nil {
+			t.Fatal(err)
+		}
+		if p, err := g.Get("Tom"); err != nil || p.Score != 999 || counting.decodes.Load() != 2 {
+			t.Fatalf("%s: after Set, Get(Tom) = %v, %v, %d decodes", name, p, err, counting.decodes.Load())
+		}
+		if _, err := g.Get("missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("%s: expect ErrNotFound, got %v", name, err)
+		}
+	}
+
+	pg := NewTypedGroup[*pb.Response]("typed-proto", 2<<10, ProtoCodec[*pb.Response]{},
+		func(ctx context.Context, key string) (*pb.Response, error) {
+			return &pb.Response{Value: []byte(key), Expire: 42}, nil
+		})
+	if res, err := pg.Get("Tom"); err != nil || string(res.Value) != "Tom" || res.Expire != 42 {
+		t.Fatalf("proto: Get(Tom) = %v, %v", res, err)
+	}
+
+	// 容量小于 4 字节时解码缓存仍有上限，不会无限增长
+	tiny := NewTypedGroup[player]("typed-tiny", 3, JSONCodec[player]{}, loader)
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		if _, err := tiny.Get(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := tiny.decoded.Len(); n != 0 {
+		t.Fatalf("tiny group keeps %d decoded values, want none", n)
+	}
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"geecache"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
 var db = map[string]string{
@@ -21,16 +28,31 @@ func createGroup() *geecache.Group {
 			if v, ok := db[key]; ok {
 				return []byte(v), nil
 			}
-			return nil, fmt.Errorf("%s not exist", key)
-		}))
+			return nil, fmt.Errorf("%s not exist: %w", key, geecache.ErrNotFound)
+		}), geecache.WithNegativeTTL(5*time.Second))
 }
 
-func startCacheServer(addr string, addrs []string, gee *geecache.Group) {
-	peers := geecache.NewHTTPPool(addr)
+func startCacheServer(addr string, addrs []string, gee *geecache.Group, opts *geecache.HTTPPoolOptions) {
+	peers := geecache.NewHTTPPoolOpts(addr, opts)
 	peers.Set(addrs...)
+	// 定期探测其他节点，宕机的节点会被移出哈希环
+	peers.StartHealthCheck(time.Second)
 	gee.RegisterPeers(peers)
 	log.Println("geecache is running at ", addr)
-	log.Fatal(http.ListenAndServe(addr[7:], peers))
+	log.Fatal(peers.ListenAndServe(addr[strings.Index(addr, "//")+2:]))
+}
+
+// 使用 gRPC 作为节点间的传输方式，节点地址格式为 host:port
+func startGRPCCacheServer(addr string, addrs []string, gee *geecache.Group) {
+	peers := geecache.NewGRPCPool(addr)
+	peers.Set(addrs...)
+	gee.RegisterPeers(peers)
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("geecache is running at ", addr)
+	log.Fatal(peers.NewServer().Serve(l))
 }
 
 func startAPIServer(apiAddr string, gee *geecache.Group) {
@@ -38,6 +60,10 @@ func startAPIServer(apiAddr string, gee *geecache.Group) {
 		func(w http.ResponseWriter, r *http.Request) {
 			key := r.URL.Query().Get("key")
 			view, err := gee.Get(key)
+			if errors.Is(err, geecache.ErrNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -48,26 +74,81 @@ func startAPIServer(apiAddr string, gee *geecache.Group) {
 	log.Println("fontend server is running at ", apiAddr)
 	log.Fatal(http.ListenAndServe(apiAddr[7:], nil))
 }
+
+// 启动时从快照恢复缓存，收到退出信号时保存快照后退出
+func restoreSnapshot(path string, gee *geecache.Group) {
+	n, err := gee.LoadSnapshotFile(path)
+	if err != nil {
+		// 快照损坏时忽略，节点以空缓存启动
+		log.Printf("ignore snapshot %s: %v", path, err)
+	} else {
+		log.Printf("restored %d entries from %s", n, path)
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		if err := gee.SaveSnapshotFile(path); err != nil {
+			log.Printf("save snapshot %s: %v", path, err)
+		}
+		os.Exit(0)
+	}()
+}
+
 func main() {
 	var port int
 	var api bool
+	var transport string
+	var snapshot string
+	var certFile, keyFile, caFile string
 	flag.IntVar(&port, "port", 8001, "GeeCache server port")
 	flag.BoolVar(&api, "api", false, "Start a api server?")
+	flag.StringVar(&transport, "transport", "http", "Peer transport: http or grpc")
+	flag.StringVar(&snapshot, "snapshot", "", "Cache snapshot file, loaded at startup and saved on exit")
+	flag.StringVar(&certFile, "tls-cert", "", "Peer TLS certificate (PEM), enables https between peers")
+	flag.StringVar(&keyFile, "tls-key", "", "Peer TLS private key (PEM)")
+	flag.StringVar(&caFile, "tls-ca", "", "CA certificate (PEM) for verifying peers, enables mTLS")
 	flag.Parse()
 
+	// 节点间请求签名的密钥从环境变量读取，避免出现在进程参数中
+	opts := &geecache.HTTPPoolOptions{Secret: []byte(os.Getenv("GEECACHE_SECRET"))}
+	scheme := "http://"
+	if certFile != "" {
+		cfg, err := geecache.LoadTLSConfig(certFile, keyFile, caFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.TLSConfig = cfg
+		scheme = "https://"
+	}
+
 	apiAddr := "http://localhost:9999"
 	addrMap := map[int]string{
-		8001: "http://localhost:8001",
-		8002: "http://localhost:8002",
-		8003: "http://localhost:8003",
+		8001: scheme + "localhost:8001",
+		8002: scheme + "localhost:8002",
+		8003: scheme + "localhost:8003",
 	}
 	var addrs []string
 	for _, v := range addrMap {
 		addrs = append(addrs, v)
 	}
 	gee := createGroup()
+	// 在加入节点池之前恢复缓存
+	if snapshot != "" {
+		restoreSnapshot(snapshot, gee)
+	}
 	if api {
 		go startAPIServer(apiAddr, gee)
 	}
-	startCacheServer(addrMap[port], addrs, gee)
+	switch transport {
+	case "http":
+		startCacheServer(addrMap[port], addrs, gee, opts)
+	case "grpc":
+		for i := range addrs {
+			addrs[i] = strings.TrimPrefix(addrs[i], scheme)
+		}
+		startGRPCCacheServer(strings.TrimPrefix(addrMap[port], scheme), addrs, gee)
+	default:
+		log.Fatalf("unknown transport %q", transport)
+	}
 }